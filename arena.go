@@ -0,0 +1,66 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import "sync"
+
+// An Arena is a Factory that tracks every document, array and value copy it
+// creates, including copies made by Get, Value and Clone, so they can all be
+// released with a single call to Close, e.g. at the end of a request.
+//
+// After Close, the documents are invalid and report ErrBufferReleased, just
+// as if Release had been called on each.  Releasing a document before Close
+// is allowed.  The arena may be used again after Close; later documents are
+// released by the next Close.  An Arena is safe for concurrent use.
+type Arena struct {
+	*Factory
+}
+
+// A tracker records releasable objects created by a scoped factory.
+type tracker struct {
+	mu    sync.Mutex
+	items []releaser
+}
+
+type releaser interface {
+	Release()
+}
+
+// Scope returns an Arena that shares the factory's pool and settings.
+func (f *Factory) Scope() *Arena {
+	scoped := *f
+	scoped.tracker = &tracker{}
+	return &Arena{Factory: &scoped}
+}
+
+// Close releases everything created by the arena since it was created or
+// last closed.
+func (a *Arena) Close() {
+	t := a.tracker
+	t.mu.Lock()
+	items := t.items
+	t.items = nil
+	t.mu.Unlock()
+	for _, x := range items {
+		// Skip documents already released, which would panic in debug mode.
+		// A later Add may have replaced the error, so check validity.
+		if d, ok := x.(*Doc); ok && !d.valid {
+			continue
+		}
+		x.Release()
+	}
+}
+
+// track records r for release by an arena, if the factory is scoped.
+func (f *Factory) track(r releaser) {
+	if f.tracker == nil {
+		return
+	}
+	f.tracker.mu.Lock()
+	f.tracker.items = append(f.tracker.items, r)
+	f.tracker.mu.Unlock()
+}
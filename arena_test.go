@@ -0,0 +1,106 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	arena := NewFromPool(pool).Scope()
+
+	d := arena.NewDoc().AddDoc("sub", arena.NewDoc().AddInt32("x", 1))
+	sized := arena.NewDocWithCapacity(64).AddString("s", "t")
+	a := arena.NewArray(int32(1), "two")
+	fromBytes, err := arena.NewDocFromBytes([]byte{5, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromReader, err := arena.NewDocFromReader(bytes.NewReader([]byte{5, 0, 0, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := arena.NewBuilder().Add("b", true).Doc()
+
+	iter := d.Iter()
+	iter.Next()
+	value := iter.Value()
+	sub := iter.Get().(*Doc)
+
+	// Releasing before Close is fine.
+	sized.Release()
+
+	docs := []*Doc{d, sized, a.d, fromBytes, fromReader, built, sub}
+	for _, x := range docs {
+		if x != sized && !x.Valid() {
+			t.Fatalf("document invalid before Close: %v", x.Err())
+		}
+	}
+
+	arena.Close()
+
+	for i, x := range docs {
+		if x.Valid() || x.Err() != ErrBufferReleased {
+			t.Errorf("document %d not released: valid %v, err %v", i, x.Valid(), x.Err())
+		}
+	}
+	if value.Err() != ErrBufferReleased {
+		t.Errorf("value not released: %v", value.Err())
+	}
+	if d.AddInt32("y", 2).Err() != ErrImmutable {
+		t.Error("adding to a closed document should fail")
+	}
+	// The slice passed to NewDocFromBytes didn't come from the pool, but
+	// was put there on release.
+	if s := pool.Stats(); s.Puts != s.Gets+1 {
+		t.Errorf("gets and puts don't balance: %+v", s)
+	}
+
+	// Releasing again, or closing again, is harmless.
+	d.Release()
+	value.Release()
+	arena.Close()
+
+	// The arena can be reused.
+	again := arena.NewDoc()
+	arena.Close()
+	if again.Valid() {
+		t.Error("document created after Close wasn't released by the next Close")
+	}
+}
+
+func TestArenaConcurrent(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	arena := NewFromPool(pool).Scope()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				arena.NewDoc().AddString("k", "v")
+			}
+		}()
+	}
+	wg.Wait()
+	arena.Close()
+	if s := pool.Stats(); s.Gets != 400 || s.Puts != 400 {
+		t.Errorf("unbalanced: %+v", s)
+	}
+}
+
+func TestReleaseTwice(t *testing.T) {
+	d := fct.NewDoc()
+	d.Release()
+	d.Release()
+	if d.Err() != ErrBufferReleased {
+		t.Errorf("unexpected error: %v", d.Err())
+	}
+}
@@ -10,8 +10,6 @@ import (
 	"io"
 	"strconv"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // An Array ...
@@ -41,7 +39,7 @@ func (a *Array) Release() {
 
 // Iter ...
 func (a *Array) Iter() *ArrayIter {
-	return &ArrayIter{di: newDocIter(a.d)}
+	return newArrayIter(a)
 }
 
 // Reader ...
@@ -59,6 +57,12 @@ func (a *Array) Len() int {
 	return len(a.d.buf)
 }
 
+// BytesUnsafe returns the encoded array without copying, subject to the same
+// restrictions as Doc.BytesUnsafe.
+func (a *Array) BytesUnsafe() []byte {
+	return a.d.BytesUnsafe()
+}
+
 // Concat ..
 func (a *Array) Concat(src *Array) *Array {
 	// XXX Unimplemented: Need to iterate src and add valueUnsafe to keep key
@@ -74,7 +78,7 @@ func (a *Array) Clone() *Array {
 // Add ...
 func (a *Array) Add(xs ...interface{}) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	for _, v := range xs {
@@ -87,7 +91,7 @@ func (a *Array) Add(xs ...interface{}) *Array {
 // AddDouble ...
 func (a *Array) AddDouble(v float64) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDouble(strconv.Itoa(a.n), v)
@@ -98,7 +102,7 @@ func (a *Array) AddDouble(v float64) *Array {
 // AddString ...
 func (a *Array) AddString(v string) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddString(strconv.Itoa(a.n), v)
@@ -109,7 +113,7 @@ func (a *Array) AddString(v string) *Array {
 // AddDoc ...
 func (a *Array) AddDoc(v *Doc) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDoc(strconv.Itoa(a.n), v)
@@ -120,7 +124,7 @@ func (a *Array) AddDoc(v *Doc) *Array {
 // AddArray ...
 func (a *Array) AddArray(v *Array) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddArray(strconv.Itoa(a.n), v)
@@ -129,9 +133,9 @@ func (a *Array) AddArray(v *Array) *Array {
 }
 
 // AddBinary ...
-func (a *Array) AddBinary(v *primitive.Binary) *Array {
+func (a *Array) AddBinary(v *Binary) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddBinary(strconv.Itoa(a.n), v)
@@ -142,7 +146,7 @@ func (a *Array) AddBinary(v *primitive.Binary) *Array {
 // AddUndefined
 func (a *Array) AddUndefined() *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddUndefined(strconv.Itoa(a.n))
@@ -151,9 +155,9 @@ func (a *Array) AddUndefined() *Array {
 }
 
 // AddOID ...
-func (a *Array) AddOID(v primitive.ObjectID) *Array {
+func (a *Array) AddOID(v ObjectID) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddOID(strconv.Itoa(a.n), v)
@@ -164,7 +168,7 @@ func (a *Array) AddOID(v primitive.ObjectID) *Array {
 // AddBool ...
 func (a *Array) AddBool(v bool) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddBool(strconv.Itoa(a.n), v)
@@ -173,9 +177,9 @@ func (a *Array) AddBool(v bool) *Array {
 }
 
 // AddDateTime ...
-func (a *Array) AddDateTime(v primitive.DateTime) *Array {
+func (a *Array) AddDateTime(v DateTime) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDateTime(strconv.Itoa(a.n), v)
@@ -186,7 +190,7 @@ func (a *Array) AddDateTime(v primitive.DateTime) *Array {
 // AddDateTimeFromTime ...
 func (a *Array) AddDateTimeFromTime(v time.Time) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDateTimeFromTime(strconv.Itoa(a.n), v)
@@ -197,7 +201,7 @@ func (a *Array) AddDateTimeFromTime(v time.Time) *Array {
 // AddNull ...
 func (a *Array) AddNull() *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddNull(strconv.Itoa(a.n))
@@ -206,9 +210,9 @@ func (a *Array) AddNull() *Array {
 }
 
 // AddRegex ...
-func (a *Array) AddRegex(v primitive.Regex) *Array {
+func (a *Array) AddRegex(v Regex) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddRegex(strconv.Itoa(a.n), v)
@@ -217,9 +221,9 @@ func (a *Array) AddRegex(v primitive.Regex) *Array {
 }
 
 // AddDBPointer ...
-func (a *Array) AddDBPointer(v primitive.DBPointer) *Array {
+func (a *Array) AddDBPointer(v DBPointer) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDBPointer(strconv.Itoa(a.n), v)
@@ -228,9 +232,9 @@ func (a *Array) AddDBPointer(v primitive.DBPointer) *Array {
 }
 
 // AddJavaScript ...
-func (a *Array) AddJavaScript(v primitive.JavaScript) *Array {
+func (a *Array) AddJavaScript(v JavaScript) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddJavaScript(strconv.Itoa(a.n), v)
@@ -239,9 +243,9 @@ func (a *Array) AddJavaScript(v primitive.JavaScript) *Array {
 }
 
 // AddSymbol ...
-func (a *Array) AddSymbol(v primitive.Symbol) *Array {
+func (a *Array) AddSymbol(v Symbol) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddSymbol(strconv.Itoa(a.n), v)
@@ -252,7 +256,7 @@ func (a *Array) AddSymbol(v primitive.Symbol) *Array {
 // AddCodeScope ...
 func (a *Array) AddCodeScope(v CodeWithScope) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddCodeScope(strconv.Itoa(a.n), v)
@@ -263,7 +267,7 @@ func (a *Array) AddCodeScope(v CodeWithScope) *Array {
 // AddInt32 ...
 func (a *Array) AddInt32(v int32) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddInt32(strconv.Itoa(a.n), v)
@@ -272,9 +276,9 @@ func (a *Array) AddInt32(v int32) *Array {
 }
 
 // AddTimestamp ...
-func (a *Array) AddTimestamp(v primitive.Timestamp) *Array {
+func (a *Array) AddTimestamp(v Timestamp) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddTimestamp(strconv.Itoa(a.n), v)
@@ -285,7 +289,7 @@ func (a *Array) AddTimestamp(v primitive.Timestamp) *Array {
 // AddInt64 ...
 func (a *Array) AddInt64(v int64) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddInt64(strconv.Itoa(a.n), v)
@@ -294,9 +298,9 @@ func (a *Array) AddInt64(v int64) *Array {
 }
 
 // AddDecimal128 ...
-func (a *Array) AddDecimal128(v primitive.Decimal128) *Array {
+func (a *Array) AddDecimal128(v Decimal128) *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddDecimal128(strconv.Itoa(a.n), v)
@@ -307,7 +311,7 @@ func (a *Array) AddDecimal128(v primitive.Decimal128) *Array {
 // AddMaxKey ...
 func (a *Array) AddMaxKey() *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddMaxKey(strconv.Itoa(a.n))
@@ -318,10 +322,21 @@ func (a *Array) AddMaxKey() *Array {
 // AddMinKey ...
 func (a *Array) AddMinKey() *Array {
 	if a.d.immutable || !a.d.valid {
-		a.d.err = errImmutableInvalid
+		a.d.err = ErrImmutable
 		return a
 	}
 	a.d.AddMinKey(strconv.Itoa(a.n))
 	a.n++
 	return a
 }
+
+// AddValue ...
+func (a *Array) AddValue(v Value) *Array {
+	if a.d.immutable || !a.d.valid {
+		a.d.err = ErrImmutable
+		return a
+	}
+	a.d.AddValue(strconv.Itoa(a.n), v)
+	a.n++
+	return a
+}
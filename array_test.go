@@ -4,21 +4,28 @@ import (
 	"fmt"
 	"testing"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func testArrayAdd(t *testing.T, addCases []AddTestCase) {
+// testArrayAdd tests arrays from the factory f, whose name is added to the
+// subtest names if not empty.
+func testArrayAdd(t *testing.T, f *Factory, name string, addCases []AddTestCase) {
+	if name != "" {
+		name = " (" + name + ")"
+	}
 	// Array.Add is a wrapper around Doc.Add, so we can use the same input data.
-	t.Run("Array.Add", func(t *testing.T) {
+	t.Run("Array.Add"+name, func(t *testing.T) {
 		for _, c := range addCases {
 			// replace key in document with "0" (ASCII 0x30)
 			aHex := c.D[0:10] + "30" + c.D[12:]
 
-			a := fct.NewArray()
+			a := f.NewArray()
 			a.Add(c.V)
 			compareArrayHex(t, a, aHex, c.L)
 			a.Release()
+
+			a = f.NewArray(c.V)
+			compareArrayHex(t, a, aHex, c.L+" (NewArray)")
+			a.Release()
 		}
 	})
 
@@ -26,12 +33,12 @@ func testArrayAdd(t *testing.T, addCases []AddTestCase) {
 	// because Doc.Add delegates to the type-specific adders, but Array.Add
 	// delegates to Doc.Add.  Therefore, we have to do our own type-specific
 	// test for arrays.
-	t.Run("Array.AddType", func(t *testing.T) {
+	t.Run("Array.AddType"+name, func(t *testing.T) {
 		for _, c := range addCases {
 			// replace key in document with "0" (ASCII 0x30)
 			aHex := c.D[0:10] + "30" + c.D[12:]
 
-			a := fct.NewArray()
+			a := f.NewArray()
 			if addByType(a, c.V) {
 				compareArrayHex(t, a, aHex, c.L)
 			}
@@ -68,17 +75,17 @@ func addByType(a *Array, v interface{}) bool {
 		a.AddArray(x)
 
 	// Type 05 - binary
-	case primitive.Binary:
+	case Binary:
 		a.AddBinary(&x)
-	case *primitive.Binary:
+	case *Binary:
 		a.AddBinary(x)
 
 	// Type 06 - undefined (deprecated)
-	case primitive.Undefined:
+	case Undefined:
 		a.AddUndefined()
 
 	// Type 07 - ObjectID
-	case primitive.ObjectID:
+	case ObjectID:
 		a.AddOID(x)
 
 	// Type 08 - boolean
@@ -86,7 +93,7 @@ func addByType(a *Array, v interface{}) bool {
 		a.AddBool(x)
 
 	// Type 09 - UTC DateTime
-	case primitive.DateTime:
+	case DateTime:
 		a.AddDateTime(x)
 	case time.Time:
 		a.AddDateTimeFromTime(x)
@@ -98,38 +105,35 @@ func addByType(a *Array, v interface{}) bool {
 		a.AddNull()
 
 	// Type 0B - regular expression
-	case primitive.Regex:
+	case Regex:
 		a.AddRegex(x)
-	case *primitive.Regex:
+	case *Regex:
 		a.AddRegex(*x)
 
 	// Type 0C - DBPointer (deprecated)
-	case primitive.DBPointer:
+	case DBPointer:
 		a.AddDBPointer(x)
-	case *primitive.DBPointer:
+	case *DBPointer:
 		a.AddDBPointer(*x)
 
 	// Type 0D - JavaScript code
-	case primitive.JavaScript:
+	case JavaScript:
 		a.AddJavaScript(x)
 
 	// Type 0E - Symbol (deprecated)
-	case primitive.Symbol:
+	case Symbol:
 		a.AddSymbol(x)
 
 		// Type 0F - JavaScript code with scope
 	case CodeWithScope:
 		a.AddCodeScope(x)
-	case primitive.CodeWithScope:
-		// AddCodeScope doesn't convert this, only Add, so skip test
-		return false
 
 	// Type 10 - 32-bit integer
 	case int32:
 		a.AddInt32(x)
 
 		// Type 11 - timestamp
-	case primitive.Timestamp:
+	case Timestamp:
 		a.AddTimestamp(x)
 
 	// Type 12 - 64-bit integer
@@ -137,17 +141,17 @@ func addByType(a *Array, v interface{}) bool {
 		a.AddInt64(x)
 
 		// Type 13 - 128-bit decimal floating point
-	case primitive.Decimal128:
+	case Decimal128:
 		a.AddDecimal128(x)
-	case *primitive.Decimal128:
+	case *Decimal128:
 		a.AddDecimal128(*x)
 
 	// Type FF - Min key
-	case primitive.MinKey:
+	case MinKey:
 		a.AddMinKey()
 
 	// Type 7F - Max key
-	case primitive.MaxKey:
+	case MaxKey:
 		a.AddMaxKey()
 
 	default:
@@ -156,3 +160,20 @@ func addByType(a *Array, v interface{}) bool {
 
 	return true
 }
+
+func TestArrayIterIndex(t *testing.T) {
+	a := New().NewArray("a", "b")
+	defer a.Release()
+	iter := a.Iter()
+	if iter.Index() != -1 {
+		t.Errorf("index before Next: %d", iter.Index())
+	}
+	for i := 0; iter.Next(); i++ {
+		if iter.Index() != i {
+			t.Errorf("index %d: got %d", i, iter.Index())
+		}
+	}
+	if iter.Index() != -1 {
+		t.Errorf("index after end: %d", iter.Index())
+	}
+}
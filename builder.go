@@ -0,0 +1,137 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Builder builds a document in two passes: Add records elements and totals
+// their encoded size, then Doc allocates a buffer of exactly that size and
+// encodes the elements into it without resizing.
+//
+// Values are referenced, not copied, until Doc is called, so documents and
+// arrays added must not be released or modified before then.
+//
+// Passing values as interface{} can itself allocate.  When the size of a
+// document is known in advance, NewDocWithCapacity with the typed Add
+// methods is cheaper.
+type Builder struct {
+	f    *Factory
+	keys []string
+	vals []interface{}
+	size int
+}
+
+// NewBuilder returns an empty Builder for documents from the factory.
+func (f *Factory) NewBuilder() *Builder {
+	return &Builder{f: f, size: 5}
+}
+
+// Add records an element to be added to the document.  It accepts the same
+// types as Doc.Add and likewise panics for unsupported types.
+func (b *Builder) Add(k string, v interface{}) *Builder {
+	n, ok := valueSize(v)
+	if !ok {
+		panic(fmt.Sprintf("unsupported type: %T", v))
+	}
+	// Type byte + key + null byte + value data
+	b.size += 2 + len(k) + n
+	b.keys = append(b.keys, k)
+	b.vals = append(b.vals, v)
+	return b
+}
+
+// Len returns the encoded length of the document built so far.
+func (b *Builder) Len() int {
+	return b.size
+}
+
+// Doc returns a new document with the recorded elements and resets the
+// builder for reuse.
+func (b *Builder) Doc() *Doc {
+	d := b.f.NewDocWithCapacity(b.size)
+	for i, k := range b.keys {
+		d.Add(k, b.vals[i])
+	}
+	b.Reset()
+	return d
+}
+
+// Reset discards the recorded elements.
+func (b *Builder) Reset() {
+	for i := range b.vals {
+		b.vals[i] = nil
+	}
+	b.keys = b.keys[:0]
+	b.vals = b.vals[:0]
+	b.size = 5
+}
+
+// valueSize returns the number of bytes needed to encode the data of a value
+// accepted by Doc.Add, or false if the type is unsupported.
+func valueSize(v interface{}) (int, bool) {
+	switch x := v.(type) {
+	case float32, float64, DateTime, time.Time, *time.Time, Timestamp, int64:
+		return 8, true
+	case string:
+		return 5 + len(x), true
+	case Doc:
+		return x.Len(), true
+	case *Doc:
+		return x.Len(), true
+	case Array:
+		return x.Len(), true
+	case *Array:
+		return x.Len(), true
+	case Binary:
+		return binarySize(&x), true
+	case *Binary:
+		return binarySize(x), true
+	case Undefined, nil, MinKey, MaxKey:
+		return 0, true
+	case ObjectID:
+		return 12, true
+	case bool:
+		return 1, true
+	case Regex:
+		return 2 + len(x.Pattern) + len(x.Options), true
+	case *Regex:
+		return 2 + len(x.Pattern) + len(x.Options), true
+	case DBPointer:
+		return 17 + len(x.DB), true
+	case *DBPointer:
+		return 17 + len(x.DB), true
+	case JavaScript:
+		return 5 + len(x), true
+	case Symbol:
+		return 5 + len(x), true
+	case CodeWithScope:
+		// Total length + code length + code + null byte + scope
+		n := 9 + len(x.Code)
+		if x.Scope != nil {
+			return n + x.Scope.Len(), true
+		}
+		return n + 5, true
+	case int32:
+		return 4, true
+	case Decimal128, *Decimal128:
+		return 16, true
+	default:
+		return 0, false
+	}
+}
+
+func binarySize(v *Binary) int {
+	// Length + subtype byte + payload; subtype 2 repeats the payload length
+	n := 5 + len(v.Data)
+	if v.Subtype == 2 {
+		n += 4
+	}
+	return n
+}
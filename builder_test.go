@@ -0,0 +1,126 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func builderValues(fct *Factory) []interface{} {
+	oid, _ := ObjectIDFromHex("56e1fc72e0c917e9c4714161")
+	dec, _ := ParseDecimal128("1.5")
+	now := time.Now()
+	return []interface{}{
+		1.5, float32(2.5), "string", fct.NewDoc().AddInt32("x", 1), *fct.NewDoc(),
+		fct.NewArray("a", "b"), *fct.NewArray(), Binary{Subtype: 0, Data: []byte{1, 2}},
+		&Binary{Subtype: 2, Data: []byte{1, 2, 3}}, Undefined{}, oid, true, DateTime(1), now, &now,
+		nil, Regex{Pattern: "a", Options: "i"}, &Regex{Pattern: "b"}, DBPointer{DB: "db", Pointer: oid},
+		&DBPointer{DB: "x", Pointer: oid}, JavaScript("f()"), Symbol("s"),
+		CodeWithScope{Code: "c", Scope: fct.NewDoc().AddString("y", "z")}, CodeWithScope{Code: "c"},
+		int32(3), Timestamp{T: 1, I: 2}, int64(4), dec, &dec, MinKey{}, MaxKey{},
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	pool := NewBytePool(0, -1)
+	fct := NewFromPool(pool)
+	vals := builderValues(fct)
+
+	want := fct.NewDoc()
+	b := fct.NewBuilder()
+	for i, v := range vals {
+		k := strings.Repeat("k", i)
+		want.Add(k, v)
+		b.Add(k, v)
+	}
+	if b.Len() != want.Len() {
+		t.Fatalf("builder length: got %d, want %d", b.Len(), want.Len())
+	}
+
+	before := pool.Stats()
+	got := b.Doc()
+	after := pool.Stats()
+	compareDocs(t, got, want, "builder")
+	if after.ResizeCopies != before.ResizeCopies || after.Gets != before.Gets+1 {
+		t.Errorf("builder should get one buffer without resizing: before %+v, after %+v", before, after)
+	}
+	if cap(got.buf) != want.Len() {
+		t.Errorf("builder buffer capacity: got %d, want %d", cap(got.buf), want.Len())
+	}
+
+	// The builder is reset for reuse.
+	if b.Len() != 5 {
+		t.Errorf("builder not reset: length %d", b.Len())
+	}
+	empty := b.Doc()
+	compareDocHex(t, empty, "0500000000", "empty builder")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for unsupported type")
+		}
+	}()
+	b.Add("x", struct{}{})
+}
+
+func TestNewDocWithCapacity(t *testing.T) {
+	pool := NewBytePool(0, -1)
+	fct := NewFromPool(pool)
+	d := fct.NewDocWithCapacity(100)
+	compareDocHex(t, d, "0500000000", "new document")
+	if cap(d.buf) < 100 {
+		t.Errorf("capacity too small: %d", cap(d.buf))
+	}
+	before := pool.Stats()
+	d.AddString("a", strings.Repeat("x", 80))
+	if pool.Stats().ResizeCopies != before.ResizeCopies {
+		t.Error("adding within capacity resized the buffer")
+	}
+
+	small := fct.NewDocWithCapacity(-1)
+	compareDocHex(t, small, "0500000000", "negative capacity")
+}
+
+func benchValues() (string, int32, int64, ObjectID) {
+	return strings.Repeat("x", 40), 42, 1 << 40, NewObjectID()
+}
+
+// These benchmarks keep each document, as when documents are handed off to
+// other code, so every buffer comes from a fresh allocation.
+
+func BenchmarkAddChained(b *testing.B) {
+	fct := NewFromPool(NewBytePool(64, -1))
+	s, i32, i64, oid := benchValues()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fct.NewDoc().AddOID("_id", oid).AddString("name", s).AddInt32("count", i32).
+			AddInt64("total", i64).AddString("note", s).AddBool("ok", true)
+	}
+}
+
+func BenchmarkAddWithCapacity(b *testing.B) {
+	fct := NewFromPool(NewBytePool(64, -1))
+	s, i32, i64, oid := benchValues()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fct.NewDocWithCapacity(160).AddOID("_id", oid).AddString("name", s).AddInt32("count", i32).
+			AddInt64("total", i64).AddString("note", s).AddBool("ok", true)
+	}
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	fct := NewFromPool(NewBytePool(64, -1))
+	s, i32, i64, oid := benchValues()
+	bld := fct.NewBuilder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bld.Add("_id", oid).Add("name", s).Add("count", i32).
+			Add("total", i64).Add("note", s).Add("ok", true).Doc()
+	}
+}
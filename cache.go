@@ -0,0 +1,221 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+var errNoID = errors.New("document has no _id")
+var errCacheTooSmall = errors.New("document is larger than the cache")
+
+// A DocCache holds copies of documents keyed by their _id values, up to a
+// total size in bytes, evicting the least recently used documents to make
+// room.  Evicted documents are released, returning their buffers to the
+// factory's pool once no reader holds them.  A DocCache is safe for
+// concurrent use.
+//
+// Numeric _id values are compared by number, so int32, int64 and integral
+// double ids for the same number refer to the same document.  Other _id
+// values are compared by BSON type and bytes.
+type DocCache struct {
+	f        *Factory
+	maxBytes int
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key string
+	doc *Doc // frozen; the cache holds one reference
+}
+
+// NewDocCache returns an empty cache holding up to maxBytes bytes of
+// documents, by Doc.Len.  Cached documents are copied into buffers from the
+// factory, which must not be an Arena.
+func (f *Factory) NewDocCache(maxBytes int) *DocCache {
+	return &DocCache{
+		f:        f,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Put stores a copy of d under its _id, replacing any document with the same
+// _id, and evicts least recently used documents if the cache is over its
+// size.  The caller keeps ownership of d.  It returns an error if d is
+// invalid, has no _id or is larger than the cache, or if the copy breaks the
+// duplicate key policy or storage rules of the cache's factory.
+func (c *DocCache) Put(d *Doc) error {
+	if !d.valid {
+		return d.err
+	}
+	key, err := docCacheKey(d)
+	if err != nil {
+		return err
+	}
+	if d.Len() > c.maxBytes {
+		return errCacheTooSmall
+	}
+	cp := c.f.NewDocWithCapacity(d.Len()).Concat(d)
+	if err := cp.Err(); err != nil {
+		cp.Release()
+		return err
+	}
+	cp.Freeze()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, doc: cp})
+	c.size += cp.Len()
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// Get returns a mutable copy of the document with the given _id, which the
+// caller owns and should release, and whether it was found.  The id is any
+// value supported by Doc.Add.
+func (c *DocCache) Get(id interface{}) (*Doc, bool) {
+	v, ok := c.View(id)
+	if !ok {
+		return nil, false
+	}
+	d := v.Clone()
+	v.Release()
+	return d, true
+}
+
+// View returns the cached document with the given _id without copying it,
+// and whether it was found.  The document is frozen and shared with other
+// readers; the caller holds a reference to it and must Release it when done,
+// even if it has since been evicted.  The id is any value supported by
+// Doc.Add.
+func (c *DocCache) View(id interface{}) (*Doc, bool) {
+	key, ok := c.idKey(id)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).doc.Retain(), true
+}
+
+// Delete removes the document with the given _id, if any.
+func (c *DocCache) Delete(id interface{}) {
+	key, ok := c.idKey(id)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Clear removes all documents.
+func (c *DocCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Len returns the number of cached documents.
+func (c *DocCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the total length in bytes of the cached documents.
+func (c *DocCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// remove drops an entry and releases the cache's reference to its document.
+// The caller must hold the lock.
+func (c *DocCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.doc.Len()
+	e.doc.Release()
+}
+
+// idKey returns the cache key for an _id given as a Go value.  An id of a
+// type not supported by Doc.Add has no key.
+func (c *DocCache) idKey(id interface{}) (key string, ok bool) {
+	d := c.f.NewDoc()
+	defer d.Release()
+	defer func() {
+		if recover() != nil {
+			key, ok = "", false
+		}
+	}()
+	key, err := docCacheKey(d.Add("_id", id))
+	return key, err == nil
+}
+
+// docCacheKey returns the cache key for the _id of d.
+func docCacheKey(d *Doc) (string, error) {
+	iter := d.Iter()
+	for iter.Next() {
+		if err := iter.Err(); err != nil {
+			return "", err
+		}
+		if iter.Key() == "_id" {
+			return valueCacheKey(iter.vu), nil
+		}
+	}
+	return "", errNoID
+}
+
+// valueCacheKey returns the BSON type byte followed by the value bytes,
+// except that int32 values and doubles with an int64 value are keyed as
+// int64, so equal numbers have equal keys.
+func valueCacheKey(v *unsafeValue) string {
+	var n int64
+	switch v.t {
+	case TypeInt32:
+		n = int64(int32(binary.LittleEndian.Uint32(v.data)))
+	case TypeInt64:
+		n = int64(binary.LittleEndian.Uint64(v.data))
+	case TypeDouble:
+		x := math.Float64frombits(binary.LittleEndian.Uint64(v.data))
+		if x != math.Trunc(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+			return string(append([]byte{byte(v.t)}, v.data...))
+		}
+		n = int64(x)
+	default:
+		return string(append([]byte{byte(v.t)}, v.data...))
+	}
+	var key [9]byte
+	key[0] = byte(TypeInt64)
+	binary.LittleEndian.PutUint64(key[1:], uint64(n))
+	return string(key[:])
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDocCache(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	f := NewFromPool(pool)
+	c := f.NewDocCache(1000)
+
+	d := f.NewDoc().AddInt32("_id", 1).AddString("x", "one")
+	if err := c.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	d.Release()
+
+	// Numeric ids match by number, whatever their type.
+	for _, id := range []interface{}{int32(1), int64(1), float64(1)} {
+		got, ok := c.Get(id)
+		if !ok {
+			t.Fatalf("id %T(1) not found", id)
+		}
+		compareDocHex(t, got, "19000000105f69640001000000027800040000006f6e650000", fmt.Sprintf("Get %T", id))
+		got.AddBool("mutable", true)
+		if got.Err() != nil {
+			t.Errorf("copy from Get not mutable: %v", got.Err())
+		}
+		got.Release()
+	}
+	for _, id := range []interface{}{int32(2), float64(1.5), "1"} {
+		if _, ok := c.Get(id); ok {
+			t.Errorf("unexpected match for %T(%v)", id, id)
+		}
+	}
+
+	// Put replaces a document with the same id.
+	d = f.NewDoc().AddInt64("_id", 1).AddString("x", "uno")
+	if err := c.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	d.Release()
+	if c.Len() != 1 || c.Size() != 29 {
+		t.Errorf("wrong Len/Size after replace: %d/%d", c.Len(), c.Size())
+	}
+
+	v, ok := c.View(int32(1))
+	if !ok {
+		t.Fatal("View not found")
+	}
+	if !v.Frozen() {
+		t.Error("view not frozen")
+	}
+	compareDocHex(t, v, "1d000000125f696400010000000000000002780004000000756e6f0000", "View")
+	c.Delete(float64(1))
+	if c.Len() != 0 || c.Size() != 0 {
+		t.Errorf("wrong Len/Size after delete: %d/%d", c.Len(), c.Size())
+	}
+	if !v.Valid() {
+		t.Fatal("view released while held by a reader")
+	}
+	puts := pool.Stats().Puts
+	v.Release()
+	if v.Valid() || pool.Stats().Puts != puts+1 {
+		t.Error("view not released by last reader")
+	}
+
+	assertErr(t, c.Put(f.NewDoc().AddInt32("a", 1)), errNoID)
+	big := f.NewDoc().AddInt32("_id", 2).AddBinary("b", &Binary{Data: make([]byte, 1000)})
+	assertErr(t, c.Put(big), errCacheTooSmall)
+	big.Release()
+	released := f.NewDoc()
+	released.Release()
+	assertErr(t, c.Put(released), ErrBufferReleased)
+
+	// Ids of types Doc.Add doesn't support aren't found.
+	for _, id := range []interface{}{struct{}{}, make(chan int)} {
+		if _, ok := c.Get(id); ok {
+			t.Errorf("Get: unexpected match for %T", id)
+		}
+		if _, ok := c.View(id); ok {
+			t.Errorf("View: unexpected match for %T", id)
+		}
+		c.Delete(id)
+	}
+}
+
+func TestDocCachePutRules(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	src := New().NewDoc().AddInt32("_id", 1).AddInt32("$bad", 2)
+	defer src.Release()
+	dup := New().NewDoc().AddInt32("_id", 1).AddInt32("a", 2).AddInt32("a", 3)
+	defer dup.Release()
+	corrupt := New().NewDoc().AddInt32("_id", 1).AddString("s", "xy")
+	defer corrupt.Release()
+	// Corrupt the length of the string "s".
+	corrupt.buf[16] = 0x7f
+
+	cases := []struct {
+		label string
+		f     *Factory
+		d     *Doc
+		err   error
+	}{
+		{"storage rules", NewFromPool(pool).WithStorageRules(), src, ErrInvalidKey},
+		{"duplicate keys", NewFromPool(pool).WithDuplicateKeys(DuplicateKeysError), dup, ErrDuplicateKey},
+		{"corrupt", NewFromPool(pool).WithDuplicateKeys(DuplicateKeysError), corrupt, ErrShortDoc},
+	}
+	for _, c := range cases {
+		cache := c.f.NewDocCache(1000)
+		puts := pool.Stats().Puts
+		err := cache.Put(c.d)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: expected '%v', got '%v'", c.label, c.err, err)
+		}
+		if pool.Stats().Puts != puts+1 {
+			t.Errorf("%s: copy not released", c.label)
+		}
+		if cache.Len() != 0 {
+			t.Errorf("%s: document cached", c.label)
+		}
+		if _, ok := cache.View(int32(1)); ok {
+			t.Errorf("%s: View found document", c.label)
+		}
+	}
+}
+
+func TestDocCacheEviction(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	f := NewFromPool(pool)
+	// Each document is 16 bytes; the cache holds three.
+	c := f.NewDocCache(50)
+	put := func(id string) {
+		d := f.NewDoc().AddString("_id", id)
+		if err := c.Put(d); err != nil {
+			t.Fatal(err)
+		}
+		d.Release()
+	}
+	put("a")
+	put("b")
+	put("c")
+	if c.Size() != 48 {
+		t.Fatalf("wrong size: %d", c.Size())
+	}
+
+	// Using "a" makes "b" the least recently used.
+	if v, ok := c.View("a"); ok {
+		v.Release()
+	}
+	puts := pool.Stats().Puts
+	put("d")
+	// The evicted copy and the temporary document from put were returned.
+	if got := pool.Stats().Puts - puts; got != 2 {
+		t.Errorf("expected 2 Puts, got %d", got)
+	}
+	if _, ok := c.View("b"); ok {
+		t.Error("least recently used document not evicted")
+	}
+	for _, id := range []string{"a", "c", "d"} {
+		v, ok := c.View(id)
+		if !ok {
+			t.Errorf("document %q evicted", id)
+			continue
+		}
+		v.Release()
+	}
+
+	c.Clear()
+	if c.Len() != 0 || c.Size() != 0 {
+		t.Errorf("wrong Len/Size after Clear: %d/%d", c.Len(), c.Size())
+	}
+}
+
+func TestDocCacheConcurrent(t *testing.T) {
+	f := New()
+	c := f.NewDocCache(200)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := int32(i % 20)
+				d := f.NewDoc().AddInt32("_id", id).AddInt32("g", int32(g))
+				if err := c.Put(d); err != nil {
+					t.Error(err)
+				}
+				d.Release()
+				if v, ok := c.View(int64(id)); ok {
+					iter := v.Iter()
+					for iter.Next() {
+						_ = iter.Get()
+					}
+					v.Release()
+				}
+				if d, ok := c.Get(id); ok {
+					d.Release()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if c.Size() > 200 {
+		t.Errorf("cache over size: %d", c.Size())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// poisonByte fills buffers released by a factory in debug mode, so a view
+// that outlives its document reads obvious garbage.
+const poisonByte = 0xDB
+
+// debugOptions holds the settings of a factory in debug mode.
+type debugOptions struct {
+	report func(leak string)
+}
+
+// A docDebug records the life of a document created in debug mode.  Views
+// and iterators of the document share it, so they can tell when the document
+// has been released.
+type docDebug struct {
+	created []byte // stack trace at creation
+
+	// A frozen document may be released, and its views checked, from any
+	// goroutine.
+	mu       sync.Mutex
+	released []byte // stack trace at release; nil until released
+}
+
+// WithDebug turns on checks for lifetime bugs and returns the factory.  It is
+// meant for test suites and is too slow for production use.  It must be
+// called before the factory is used.  In debug mode:
+//
+// - Released buffers are filled with a poison byte and never returned to the
+// pool, so stale data can't be mistaken for a live document.
+//
+// - Iterators and unsafe values remember their source document and panic
+// if used after it is released, with the stack trace of the release.
+//
+// - Releasing a document twice panics with the stack traces of both
+// releases.  Documents released before an Arena is closed are not released
+// again by Close.
+//
+// - A document that is garbage collected without being released is
+// reported as a leak, with the stack trace of its creation, by calling
+// report from a finalizer.  If report is nil, leaks are logged with the log
+// package.
+//
+// Documents are checked individually; values copied with Value or Clone are
+// poisoned on release but not otherwise tracked.
+func (f *Factory) WithDebug(report func(leak string)) *Factory {
+	if report == nil {
+		report = func(leak string) { log.Print(leak) }
+	}
+	f.dbg = &debugOptions{report: report}
+	return f
+}
+
+// watch starts tracking a document created in debug mode.
+func (o *debugOptions) watch(d *Doc) {
+	d.dbg = &docDebug{created: debug.Stack()}
+	runtime.SetFinalizer(d, func(d *Doc) {
+		if d.dbg.releasedAt() == nil {
+			o.report(fmt.Sprintf("bsony: document leaked without Release; created at:\n%s", d.dbg.created))
+		}
+	})
+}
+
+// release records the release of a document, panicking if it was already
+// released.  It is safe to call on a nil docDebug.
+func (dd *docDebug) release() {
+	if dd == nil {
+		return
+	}
+	stack := debug.Stack()
+	dd.mu.Lock()
+	first := dd.released
+	if first == nil {
+		dd.released = stack
+	}
+	dd.mu.Unlock()
+	if first != nil {
+		panic(fmt.Sprintf("bsony: document released twice\n\nfirst released at:\n%s\nreleased again at:\n%s", first, stack))
+	}
+}
+
+// releasedAt returns the stack trace of the release of the document, or nil
+// if it hasn't been released.
+func (dd *docDebug) releasedAt() []byte {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	return dd.released
+}
+
+// check panics if the document has been released, naming the operation
+// attempted.  It is safe to call on a nil docDebug.
+func (dd *docDebug) check(op string) {
+	if dd == nil {
+		return
+	}
+	if released := dd.releasedAt(); released != nil {
+		panic(fmt.Sprintf("bsony: %s after document released\n\nreleased at:\n%s", op, released))
+	}
+}
+
+// poison overwrites the full capacity of buf with poisonByte.
+func poison(buf []byte) {
+	buf = buf[0:cap(buf)]
+	for i := range buf {
+		buf[i] = poisonByte
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// assertPanics calls fn and checks that it panics with a message containing
+// each of the wanted substrings.
+func assertPanics(t *testing.T, label string, fn func(), want ...string) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Errorf("%s: expected panic", label)
+			return
+		}
+		msg, _ := r.(string)
+		for _, w := range want {
+			if !strings.Contains(msg, w) {
+				t.Errorf("%s: panic message missing %q:\n%s", label, w, msg)
+			}
+		}
+	}()
+	fn()
+}
+
+func TestDebugDoubleRelease(t *testing.T) {
+	f := New().WithDebug(nil)
+	d := f.NewDoc().AddInt32("a", 1)
+	d.Release()
+	assertPanics(t, "double release", d.Release, "released twice", "first released at", "TestDebugDoubleRelease")
+
+	a := f.NewArray(int32(1))
+	a.Release()
+	assertPanics(t, "double array release", a.Release, "released twice")
+
+	// Without debug mode, a second Release is harmless.
+	d = New().NewDoc()
+	d.Release()
+	d.Release()
+}
+
+func TestDebugUseAfterRelease(t *testing.T) {
+	f := New().WithDebug(nil)
+	d := f.NewDoc().AddInt32("a", 1).AddString("b", "c")
+	buf := d.buf
+	iter := d.Iter()
+	iter.Next()
+	v := iter.ValueUnsafe()
+	copied := iter.Value()
+	d.Release()
+
+	for i, b := range buf[0:cap(buf)] {
+		if b != poisonByte {
+			t.Fatalf("released buffer not poisoned at offset %d: %02x", i, b)
+		}
+	}
+
+	assertPanics(t, "Value.Get", func() { v.Get() }, "Value.Get after document released", "released at")
+	assertPanics(t, "Value.CopyTo", func() { v.CopyTo(make([]byte, 4)) }, "Value.CopyTo")
+	assertPanics(t, "Value.Clone", func() { v.Clone() }, "Value.Clone")
+	assertPanics(t, "Value.String", func() { _ = v.(fmt.Stringer).String() }, "Value.String")
+	assertPanics(t, "DocIter.Next", func() { iter.Next() }, "DocIter.Next")
+	assertPanics(t, "DocIter.Key", func() { iter.Key() }, "DocIter.Key")
+
+	// Copies are independent of the source document.
+	if got := copied.Get(); got != int32(1) {
+		t.Errorf("copied value incorrect: got %v", got)
+	}
+	copied.Release()
+}
+
+func TestDebugViewAfterRelease(t *testing.T) {
+	f := New().WithDebug(nil)
+	d := f.NewDoc().
+		AddDoc("d", f.NewDoc().AddInt32("x", 1)).
+		AddArray("a", f.NewArray(int32(1))).
+		AddCodeScope("c", CodeWithScope{Code: "x", Scope: f.NewDoc().AddInt32("y", 2)})
+	iter := d.Iter()
+	var views []*Doc
+	for iter.Next() {
+		v := iter.ValueUnsafe().(Viewer)
+		switch iter.Type() {
+		case TypeEmbeddedDocument:
+			view, _ := v.DocUnsafe()
+			views = append(views, view)
+		case TypeArray:
+			view, _ := v.ArrayUnsafe()
+			views = append(views, view.d)
+		case TypeCodeWithScope:
+			cs, _ := v.CodeScopeUnsafe()
+			views = append(views, cs.Scope)
+		}
+	}
+	if len(views) != 3 {
+		t.Fatalf("expected 3 views, got %d", len(views))
+	}
+	// Releasing a view doesn't release the source.
+	views[0].Release()
+	views[0].Iter().Next()
+	d.Release()
+
+	for _, view := range views {
+		view := view
+		assertPanics(t, "view DocIter.Next", func() { view.Iter().Next() }, "DocIter.Next after document released")
+	}
+}
+
+func TestDebugArena(t *testing.T) {
+	arena := New().WithDebug(nil).Scope()
+	d := arena.NewDoc()
+	d.Release()
+	arena.NewDoc()
+	arena.Close()
+	assertPanics(t, "release after Close", d.Release, "released twice")
+
+	// Adding to a released document replaces its error, but Close still
+	// knows not to release it again.
+	arena = New().WithDebug(nil).Scope()
+	d = arena.NewDoc()
+	d.Release()
+	d.AddInt32("a", 1)
+	arena.Close()
+}
+
+func TestDebugFrozenConcurrent(t *testing.T) {
+	// Run with -race: references to a frozen document are dropped by
+	// several goroutines while others still read it.
+	f := New().WithDebug(nil)
+	d := f.NewDoc().AddInt32("a", 1).Freeze()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(d *Doc) {
+			defer wg.Done()
+			iter := d.Iter()
+			for iter.Next() {
+				iter.ValueUnsafe().Get()
+			}
+			d.Release()
+		}(d.Retain())
+	}
+	d.Release()
+	wg.Wait()
+	assertPanics(t, "release after last reference", d.Release, "released twice")
+}
+
+func TestDebugLeak(t *testing.T) {
+	leaks := make(chan string, 10)
+	f := New().WithDebug(func(leak string) { leaks <- leak })
+
+	f.NewDoc().AddInt32("leaked", 1)
+	f.NewDoc().Release()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case leak := <-leaks:
+			if !strings.Contains(leak, "leaked without Release") || !strings.Contains(leak, "TestDebugLeak") {
+				t.Errorf("leak report incorrect:\n%s", leak)
+			}
+			time.Sleep(10 * time.Millisecond)
+			runtime.GC()
+			select {
+			case leak := <-leaks:
+				t.Errorf("unexpected second leak report:\n%s", leak)
+			default:
+			}
+			return
+		case <-deadline:
+			t.Fatal("leaked document not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// A SizeClassPool is a ByteSlicePool with power-of-two size classes, each
+// backed by its own sync.Pool, so small documents don't hold on to large
+// buffers and large buffers aren't handed to small documents.  Slices larger
+// than the largest class are allocated as needed and not recycled.
+//
+// Besides Get, it provides GetSize to pick a class from a size hint, which a
+// Factory uses when it knows how large a document will be.
+type SizeClassPool struct {
+	// counters is first so its 64-bit fields are aligned for atomic access.
+	counters  poolCounters
+	pools     []sync.Pool
+	minShift  uint
+	observer  PoolObserver
+	zeroOnGet bool
+	wipeOnPut bool
+}
+
+// NewSizeClassPool constructs a pool with size classes from minCap to
+// maxCap, each rounded up to a power of two.  If minCap is less than one, the
+// smallest class is one byte.  If maxCap is less than minCap, there is a
+// single class.
+func NewSizeClassPool(minCap, maxCap int) *SizeClassPool {
+	if minCap < 1 {
+		minCap = 1
+	}
+	if maxCap < minCap {
+		maxCap = minCap
+	}
+	minShift, maxShift := ceilLog2(minCap), ceilLog2(maxCap)
+	return &SizeClassPool{
+		pools:    make([]sync.Pool, maxShift-minShift+1),
+		minShift: minShift,
+	}
+}
+
+// ceilLog2 returns the smallest s such that 1<<s >= n, for n >= 1.
+func ceilLog2(n int) uint {
+	return uint(bits.Len(uint(n - 1)))
+}
+
+// WithObserver sets an observer to be notified of pool activity and returns
+// the pool.  It must be called before the pool is used.
+func (p *SizeClassPool) WithObserver(o PoolObserver) *SizeClassPool {
+	p.observer = o
+	return p
+}
+
+// WithZeroOnGet makes Get zero reused slices, as for BytePool.
+func (p *SizeClassPool) WithZeroOnGet() *SizeClassPool {
+	p.zeroOnGet = true
+	return p
+}
+
+// WithWipeOnPut makes Put zero every slice and Resize zero slices it
+// outgrows, as for BytePool.
+func (p *SizeClassPool) WithWipeOnPut() *SizeClassPool {
+	p.wipeOnPut = true
+	return p
+}
+
+// Stats returns a snapshot of the pool's activity counters, as for BytePool.
+// A Resize that copies also counts as a Get of the new slice.
+func (p *SizeClassPool) Stats() PoolStats {
+	c := &p.counters
+	return PoolStats{
+		Gets:           atomic.LoadUint64(&c.gets),
+		Puts:           atomic.LoadUint64(&c.puts),
+		Misses:         atomic.LoadUint64(&c.misses),
+		Discards:       atomic.LoadUint64(&c.discards),
+		ResizeCopies:   atomic.LoadUint64(&c.resizeCopies),
+		BytesAllocated: atomic.LoadUint64(&c.bytesAllocated),
+	}
+}
+
+func (p *SizeClassPool) observe(e PoolEvent, capacity int) {
+	if p.observer != nil {
+		p.observer.ObservePool(e, capacity)
+	}
+}
+
+// classSize returns the capacity of slices in class i.
+func (p *SizeClassPool) classSize(i int) int {
+	return 1 << (p.minShift + uint(i))
+}
+
+// Get returns a zero-length slice from the smallest size class.
+func (p *SizeClassPool) Get() []byte {
+	return p.GetSize(0)
+}
+
+// GetSize returns a zero-length slice with capacity of at least size
+// from the smallest size class that fits.  If size exceeds the largest
+// class, a new slice with capacity size is returned.
+func (p *SizeClassPool) GetSize(size int) []byte {
+	atomic.AddUint64(&p.counters.gets, 1)
+	i := 0
+	if size > 1<<p.minShift {
+		i = int(ceilLog2(size) - p.minShift)
+	}
+	if i >= len(p.pools) {
+		p.miss(size)
+		return make([]byte, 0, size)
+	}
+	bp := p.pools[i].Get()
+	if bp == nil {
+		p.miss(p.classSize(i))
+		return make([]byte, 0, p.classSize(i))
+	}
+	buf := bp.([]byte)
+	p.observe(PoolGet, cap(buf))
+	if p.zeroOnGet {
+		zeroCap(buf)
+	}
+	return buf[0:0]
+}
+
+func (p *SizeClassPool) miss(capacity int) {
+	atomic.AddUint64(&p.counters.misses, 1)
+	atomic.AddUint64(&p.counters.bytesAllocated, uint64(capacity))
+	p.observe(PoolMiss, capacity)
+}
+
+// Put returns a slice to the largest size class no bigger than its capacity.
+// Slices smaller than the smallest class or larger than the largest class
+// are discarded.
+func (p *SizeClassPool) Put(buf []byte) {
+	atomic.AddUint64(&p.counters.puts, 1)
+	if p.wipeOnPut {
+		zeroCap(buf)
+	}
+	c := cap(buf)
+	if c >= 1<<p.minShift {
+		// Floor of log2, relative to the smallest class.
+		i := bits.Len(uint(c)) - 1 - int(p.minShift)
+		if i < len(p.pools) {
+			p.observe(PoolPut, c)
+			p.pools[i].Put(buf)
+			return
+		}
+	}
+	atomic.AddUint64(&p.counters.discards, 1)
+	p.observe(PoolDiscard, c)
+}
+
+// Resize returns a slice of the desired length.  If the underlying capacity
+// is insufficient, the contents are copied to a slice from a size class at
+// least double the old capacity.  As with BytePool, the old slice is left for
+// the garbage collector rather than returned to its class: views, iterators
+// and BytesUnsafe results taken before the resize may still reference it.
+func (p *SizeClassPool) Resize(buf []byte, size int) []byte {
+	if size <= cap(buf) {
+		return buf[0:size]
+	}
+	hint := cap(buf) * 2
+	if hint < size {
+		hint = size
+	}
+	temp := p.GetSize(hint)[0:size]
+	atomic.AddUint64(&p.counters.resizeCopies, 1)
+	p.observe(PoolResizeCopy, cap(temp))
+	copy(temp, buf)
+	if p.wipeOnPut {
+		zeroCap(buf)
+	}
+	return temp
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSizeClassPool(t *testing.T) {
+	p := NewSizeClassPool(100, 1000)
+	if len(p.pools) != 4 || p.classSize(0) != 128 || p.classSize(3) != 1024 {
+		t.Fatalf("classes incorrect: %d from %d", len(p.pools), p.classSize(0))
+	}
+
+	cases := []struct {
+		hint int
+		cap  int
+	}{
+		{0, 128}, {1, 128}, {128, 128}, {129, 256}, {1000, 1024}, {1024, 1024}, {1025, 1025},
+	}
+	for _, c := range cases {
+		buf := p.GetSize(c.hint)
+		if len(buf) != 0 || cap(buf) != c.cap {
+			t.Errorf("GetSize(%d): got len %d, cap %d, want cap %d", c.hint, len(buf), cap(buf), c.cap)
+		}
+	}
+	if cap(p.Get()) != 128 {
+		t.Error("Get should use the smallest class")
+	}
+
+	buf := p.Resize(p.Get(), 100)
+	copy(buf, strings.Repeat("x", 100))
+	buf = p.Resize(buf, 200)
+	if cap(buf) != 256 || !bytes.Equal(buf[:100], []byte(strings.Repeat("x", 100))) || buf[100] != 0 {
+		t.Errorf("Resize didn't copy into the next class: cap %d", cap(buf))
+	}
+	if p.Resize(buf, 10)[9] != 'x' || cap(p.Resize(buf, 10)) != 256 {
+		t.Error("shrinking Resize should reslice")
+	}
+
+	s := p.Stats()
+	// Resize left the 128-byte slice for the garbage collector.
+	if s.ResizeCopies != 1 || s.Puts != 0 || s.Discards != 0 {
+		t.Errorf("stats incorrect: %+v", s)
+	}
+
+	p.Put(make([]byte, 0, 64))   // below the smallest class
+	p.Put(make([]byte, 0, 2048)) // above the largest class
+	p.Put(make([]byte, 0, 300))  // filed under 256
+	if s := p.Stats(); s.Discards != 2 || s.Puts != 3 {
+		t.Errorf("discards incorrect: %+v", s)
+	}
+}
+
+func TestSizeClassPoolZeroing(t *testing.T) {
+	testPoolZeroing(t, func() ByteSlicePool { return NewSizeClassPool(16, 16).WithZeroOnGet() },
+		func() ByteSlicePool { return NewSizeClassPool(16, 16).WithWipeOnPut() })
+}
+
+func TestSizeClassPoolFactory(t *testing.T) {
+	p := NewSizeClassPool(64, 1<<20)
+	fct := NewFromPool(p)
+	src := fct.NewDoc().AddString("a", strings.Repeat("x", 5000))
+	buf := make([]byte, src.Len())
+	src.CopyTo(buf)
+
+	d, err := fct.NewDocFromReader(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(d.buf) != 8192 {
+		t.Errorf("reader should use a size hint: cap %d", cap(d.buf))
+	}
+	compareDocs(t, d, src, "read document")
+
+	v := d.Iter()
+	v.Next()
+	val := v.Value()
+	if val.Len() != 5005 {
+		t.Errorf("value length: %d", val.Len())
+	}
+	val.Release()
+	d.Release()
+	src.Release()
+}
+
+func TestSizeClassPoolResizeAliasing(t *testing.T) {
+	fct := NewFromPool(NewSizeClassPool(16, 1024))
+	d := fct.NewDoc().AddInt32("a", 1)
+	before := d.BytesUnsafe()
+	want := string(before)
+	// Outgrow the 16-byte slice, then take slices from its class.
+	d.AddInt32("b", 2)
+	for i := 0; i < 4; i++ {
+		fct.NewDoc().AddInt32("x", 3)
+	}
+	if string(before) != want {
+		t.Errorf("slice referenced before resize was reused: %x", before)
+	}
+	d.Release()
+}
+
+// benchDocSizes is a mix of small documents with occasional large ones.
+var benchDocSizes = []int{50, 200, 80, 1000, 30, 60000, 120, 40, 3000, 90}
+
+func benchmarkPool(b *testing.B, pool ByteSlicePool) {
+	fct := NewFromPool(pool)
+	values := make([]string, len(benchDocSizes))
+	for i, n := range benchDocSizes {
+		values[i] = strings.Repeat("x", n)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			d := fct.NewDoc()
+			for j := 0; j < 4; j++ {
+				d.AddString("k", values[i%len(values)][:len(values[i%len(values)])/4])
+			}
+			d.Release()
+			i++
+		}
+	})
+}
+
+func BenchmarkBytePool(b *testing.B) {
+	benchmarkPool(b, NewBytePool(256, -1))
+}
+
+func BenchmarkBytePoolMax(b *testing.B) {
+	benchmarkPool(b, NewBytePool(256, 1<<16))
+}
+
+func BenchmarkSizeClassPool(b *testing.B) {
+	benchmarkPool(b, NewSizeClassPool(256, 1<<16))
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test inputs: {"a": 1}, the same document cut short, {"a": 1, "b": x} with
+// an invalid boolean byte at offset 14, and {"d": {"x": 1}, "l": ["s"], "c":
+// Code("f", {"y": 2})}.
+var cmdInputs = map[string]string{
+	"good.bson":    "0c0000001061000100000000",
+	"trunc.bson":   "0c00000010610001",
+	"corrupt.bson": "10000000106100010000000862000200",
+	"nested.bson": "3e0000000364000c0000001078000100000000046c000e0000000230000200000073" +
+		"00000f6300160000000200000066000c000000107900020000000000",
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bsony")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range cmdInputs {
+		buf, err := hex.DecodeString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), buf, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		label  string
+		args   []string
+		status int
+		stdout []string
+		stderr string
+	}{
+		{"hex good", []string{"hex", "good.bson"}, 0, []string{
+			"# good.bson: document 0\n",
+			"00000000  0c000000                          document length 12\n",
+			"00000007  01000000                            1\n",
+			"0000000b  00                                end of document\n",
+		}, ""},
+		{"hex corrupt", []string{"hex", "corrupt.bson"}, 0, []string{
+			"0000000c  6200                                key \"b\"\n",
+			"0000000e  0200                                !! invalid value: boolean data byte 2; remaining bytes\n",
+		}, ""},
+		{"hex truncated", []string{"hex", "trunc.bson"}, 0, []string{
+			"00000000  0c00000010610001                  !! invalid length: document length 12 doesn't match buffer length 8; remaining bytes\n",
+		}, ""},
+		{"hex nested", []string{"hex", "nested.bson"}, 0, []string{
+			"00000007  0c000000                            document length 12\n",
+			"0000000e  01000000                              1\n",
+			"00000012  00                                  end of document\n",
+			"00000016  0e000000                            document length 14\n",
+			"0000001b  3000                                  key \"0\"\n",
+			"0000001d  020000007300                          \"s\"\n",
+			"00000027  16000000                            code with scope length 22\n",
+			"0000002b  02000000                            string length 2\n",
+			"0000002f  6600                                \"f\"\n",
+			"00000031  0c000000                            document length 12\n",
+			"00000038  02000000                              2\n",
+			"0000003d  00                                end of document\n",
+		}, ""},
+		{"hex missing", []string{"hex", "good.bson", "missing.bson"}, 1, []string{
+			"# good.bson: document 0\n",
+		}, "bsony hex: open missing.bson: "},
+
+		{"dump canonical", []string{"dump", "good.bson", "good.bson"}, 0, []string{
+			"{\"a\":{\"$numberInt\":\"1\"}}\n{\"a\":{\"$numberInt\":\"1\"}}\n",
+		}, ""},
+		{"dump relaxed", []string{"dump", "-format", "relaxed", "good.bson"}, 0, []string{
+			"{\"a\":1}\n",
+		}, ""},
+		{"dump tree", []string{"dump", "-format", "tree", "nested.bson"}, 0, []string{
+			"{\n" +
+				"  \"d\" (embedded document, 12 bytes): {\n" +
+				"    \"x\" (32-bit integer, 4 bytes): 1\n" +
+				"  }\n" +
+				"  \"l\" (array, 14 bytes): [\n" +
+				"    \"0\" (string, 6 bytes): \"s\"\n" +
+				"  ]\n" +
+				"  \"c\" (code with scope, 22 bytes): \"f\" scope {\n" +
+				"    \"y\" (32-bit integer, 4 bytes): 2\n" +
+				"  }\n" +
+				"}\n",
+		}, ""},
+		{"dump corrupt", []string{"dump", "good.bson", "corrupt.bson"}, 1, []string{
+			"{\"a\":{\"$numberInt\":\"1\"}}\n",
+		}, "bsony dump: corrupt.bson: document 0: key 'b': "},
+		{"dump truncated", []string{"dump", "trunc.bson"}, 1, nil,
+			"bsony dump: trunc.bson: document 0: unexpected EOF\n"},
+		{"dump unknown format", []string{"dump", "-format", "xml", "good.bson"}, 1, nil,
+			"bsony dump: unknown format \"xml\"\n"},
+
+		{"validate good", []string{"validate", "good.bson", "good.bson"}, 0, []string{
+			"2 documents, 0 invalid\n",
+		}, ""},
+		{"validate corrupt", []string{"validate", "good.bson", "corrupt.bson"}, 1, []string{
+			"corrupt.bson: document 0: invalid: offset 11, path b: invalid value: boolean data byte 2\n",
+			"2 documents, 1 invalid\n",
+		}, ""},
+		{"validate truncated", []string{"validate", "-q", "trunc.bson"}, 1, []string{
+			"trunc.bson: document 0: invalid: unexpected EOF\n",
+		}, ""},
+		{"validate missing", []string{"validate", "missing.bson"}, 1, nil, "bsony validate: open missing.bson: "},
+
+		{"stats good", []string{"stats", "good.bson"}, 0, []string{
+			"documents:     1\n",
+			"total bytes:   12\n",
+			"max depth:     1\n",
+			"  32-bit integer       1\n",
+			"           4  32-bit integer       a (good.bson: document 0)\n",
+		}, ""},
+		{"stats corrupt", []string{"stats", "corrupt.bson"}, 1, nil,
+			"bsony stats: corrupt.bson: document 0: offset 11, path b: invalid value: boolean data byte 2\n"},
+		{"stats truncated", []string{"stats", "good.bson", "trunc.bson"}, 1, nil,
+			"bsony stats: trunc.bson: document 0: unexpected EOF\n"},
+		{"stats missing", []string{"stats", "missing.bson"}, 1, nil, "bsony stats: open missing.bson: "},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		status := runCommand(c.args[0], c.args[1:], &stdout, &stderr)
+		if status != c.status {
+			t.Errorf("%s: exit status %d, want %d", c.label, status, c.status)
+		}
+		for _, want := range c.stdout {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%s: output missing %q:\n%s", c.label, want, stdout.String())
+			}
+		}
+		if c.stdout == nil && stdout.Len() > 0 {
+			t.Errorf("%s: unexpected output:\n%s", c.label, stdout.String())
+		}
+		if !strings.HasPrefix(stderr.String(), c.stderr) || (c.stderr == "") != (stderr.Len() == 0) {
+			t.Errorf("%s: error output %q, want %q", c.label, stderr.String(), c.stderr)
+		}
+	}
+}
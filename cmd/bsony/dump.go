@@ -0,0 +1,120 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xdg-go/bsony"
+)
+
+func runDump(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	format := flags.String("format", "canonical", "output format: canonical, relaxed or tree")
+	flags.Parse(args)
+
+	var render func(dst []byte, d *bsony.Doc) ([]byte, error)
+	switch *format {
+	case "canonical":
+		render = func(dst []byte, d *bsony.Doc) ([]byte, error) { return appendExtJSONDoc(dst, d, true) }
+	case "relaxed":
+		render = func(dst []byte, d *bsony.Doc) ([]byte, error) { return appendExtJSONDoc(dst, d, false) }
+	case "tree":
+		render = func(dst []byte, d *bsony.Doc) ([]byte, error) { return appendTreeDoc(dst, d, 0) }
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var buf []byte
+	return eachDoc(flags.Args(), func(loc string, d *bsony.Doc, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %v", loc, err)
+		}
+		buf, err = render(buf[:0], d)
+		if err != nil {
+			return fmt.Errorf("%s: %v", loc, err)
+		}
+		buf = append(buf, '\n')
+		_, err = stdout.Write(buf)
+		return err
+	})
+}
+
+// appendTreeDoc appends an indented, one-value-per-line rendering of d that
+// shows the BSON type of every value.  Scalar values are shown in relaxed
+// Extended JSON.
+func appendTreeDoc(dst []byte, d *bsony.Doc, depth int) ([]byte, error) {
+	dst = append(dst, "{\n"...)
+	iter := d.Iter()
+	for iter.Next() {
+		var err error
+		dst, err = appendTreeValue(dst, iter.Key(), iter.Type(), iter.ValueUnsafe(), depth+1)
+		if err != nil {
+			return dst, err
+		}
+	}
+	return appendIndent(dst, depth, "}"), nil
+}
+
+func appendTreeArray(dst []byte, a *bsony.Array, depth int) ([]byte, error) {
+	dst = append(dst, "[\n"...)
+	iter := a.Iter()
+	for iter.Next() {
+		var err error
+		dst, err = appendTreeValue(dst, fmt.Sprint(iter.Index()), iter.Type(), iter.ValueUnsafe(), depth+1)
+		if err != nil {
+			return dst, err
+		}
+	}
+	return appendIndent(dst, depth, "]"), nil
+}
+
+func appendTreeValue(dst []byte, key string, t bsony.Type, v bsony.Value, depth int) ([]byte, error) {
+	if err := v.Err(); err != nil {
+		return dst, fmt.Errorf("key '%s': %w", key, err)
+	}
+	dst = appendIndent(dst, depth, "")
+	dst = appendJSONString(dst, key)
+	dst = append(dst, fmt.Sprintf(" (%s, %d bytes): ", t, v.Len())...)
+
+	// Nested documents are shown through views rather than copies.
+	views := v.(bsony.Viewer)
+	var err error
+	switch t {
+	case bsony.TypeEmbeddedDocument:
+		var sub *bsony.Doc
+		if sub, err = views.DocUnsafe(); err == nil {
+			dst, err = appendTreeDoc(dst, sub, depth)
+		}
+	case bsony.TypeArray:
+		var sub *bsony.Array
+		if sub, err = views.ArrayUnsafe(); err == nil {
+			dst, err = appendTreeArray(dst, sub, depth)
+		}
+	case bsony.TypeCodeWithScope:
+		var cs bsony.CodeWithScope
+		if cs, err = views.CodeScopeUnsafe(); err == nil {
+			dst = appendJSONString(dst, cs.Code)
+			dst = append(dst, " scope "...)
+			dst, err = appendTreeDoc(dst, cs.Scope, depth)
+		}
+	default:
+		dst, err = appendExtJSONValue(dst, v.Get(), false)
+	}
+	if err != nil {
+		return dst, fmt.Errorf("key '%s': %w", key, err)
+	}
+	return append(dst, '\n'), nil
+}
+
+func appendIndent(dst []byte, depth int, s string) []byte {
+	dst = append(dst, strings.Repeat("  ", depth)...)
+	return append(dst, s...)
+}
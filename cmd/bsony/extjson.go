@@ -0,0 +1,234 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xdg-go/bsony"
+)
+
+const rfc3339Milli = "2006-01-02T15:04:05.999Z07:00"
+
+// appendExtJSONDoc appends the MongoDB Extended JSON form of d to dst, using
+// canonical mode if canonical is true and relaxed mode otherwise.
+func appendExtJSONDoc(dst []byte, d *bsony.Doc, canonical bool) ([]byte, error) {
+	dst = append(dst, '{')
+	iter := d.Iter()
+	for n := 0; iter.Next(); n++ {
+		if err := iter.Err(); err != nil {
+			return dst, fmt.Errorf("key '%s': %w", iter.Key(), err)
+		}
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, iter.Key())
+		dst = append(dst, ':')
+		var err error
+		dst, err = appendExtJSONValue(dst, iter.Get(), canonical)
+		if err != nil {
+			return dst, fmt.Errorf("key '%s': %w", iter.Key(), err)
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+func appendExtJSONArray(dst []byte, a *bsony.Array, canonical bool) ([]byte, error) {
+	dst = append(dst, '[')
+	iter := a.Iter()
+	for n := 0; iter.Next(); n++ {
+		if err := iter.Err(); err != nil {
+			return dst, fmt.Errorf("index %d: %w", n, err)
+		}
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		var err error
+		dst, err = appendExtJSONValue(dst, iter.Get(), canonical)
+		if err != nil {
+			return dst, fmt.Errorf("index %d: %w", n, err)
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+// appendExtJSONValue appends a value decoded with Get.  Documents and arrays
+// in v are released after being written.
+func appendExtJSONValue(dst []byte, v interface{}, canonical bool) ([]byte, error) {
+	switch x := v.(type) {
+	case float64:
+		if canonical || math.IsInf(x, 0) || math.IsNaN(x) {
+			dst = append(dst, `{"$numberDouble":"`...)
+			dst = append(dst, formatDouble(x)...)
+			return append(dst, `"}`...), nil
+		}
+		return append(dst, formatDouble(x)...), nil
+	case string:
+		return appendJSONString(dst, x), nil
+	case *bsony.Doc:
+		defer x.Release()
+		return appendExtJSONDoc(dst, x, canonical)
+	case *bsony.Array:
+		defer x.Release()
+		return appendExtJSONArray(dst, x, canonical)
+	case bsony.Binary:
+		dst = append(dst, `{"$binary":{"base64":"`...)
+		dst = append(dst, base64.StdEncoding.EncodeToString(x.Data)...)
+		dst = append(dst, `","subType":"`...)
+		dst = append(dst, hex.EncodeToString([]byte{x.Subtype})...)
+		return append(dst, `"}}`...), nil
+	case bsony.Undefined:
+		return append(dst, `{"$undefined":true}`...), nil
+	case bsony.ObjectID:
+		return appendOID(dst, x), nil
+	case bool:
+		return strconv.AppendBool(dst, x), nil
+	case time.Time:
+		x = x.UTC()
+		ms := x.Unix()*1000 + int64(x.Nanosecond()/1e6)
+		if !canonical && ms >= 0 && x.Year() <= 9999 {
+			dst = append(dst, `{"$date":"`...)
+			dst = append(dst, x.Format(rfc3339Milli)...)
+			return append(dst, `"}`...), nil
+		}
+		dst = append(dst, `{"$date":{"$numberLong":"`...)
+		dst = strconv.AppendInt(dst, ms, 10)
+		return append(dst, `"}}`...), nil
+	case nil:
+		return append(dst, "null"...), nil
+	case bsony.Regex:
+		dst = append(dst, `{"$regularExpression":{"pattern":`...)
+		dst = appendJSONString(dst, x.Pattern)
+		dst = append(dst, `,"options":`...)
+		dst = appendJSONString(dst, x.Options)
+		return append(dst, "}}"...), nil
+	case bsony.DBPointer:
+		dst = append(dst, `{"$dbPointer":{"$ref":`...)
+		dst = appendJSONString(dst, x.DB)
+		dst = append(dst, `,"$id":`...)
+		dst = appendOID(dst, x.Pointer)
+		return append(dst, "}}"...), nil
+	case bsony.JavaScript:
+		dst = append(dst, `{"$code":`...)
+		dst = appendJSONString(dst, string(x))
+		return append(dst, '}'), nil
+	case bsony.Symbol:
+		dst = append(dst, `{"$symbol":`...)
+		dst = appendJSONString(dst, string(x))
+		return append(dst, '}'), nil
+	case bsony.CodeWithScope:
+		defer x.Scope.Release()
+		dst = append(dst, `{"$code":`...)
+		dst = appendJSONString(dst, x.Code)
+		dst = append(dst, `,"$scope":`...)
+		var err error
+		dst, err = appendExtJSONDoc(dst, x.Scope, canonical)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, '}'), nil
+	case int32:
+		if !canonical {
+			return strconv.AppendInt(dst, int64(x), 10), nil
+		}
+		dst = append(dst, `{"$numberInt":"`...)
+		dst = strconv.AppendInt(dst, int64(x), 10)
+		return append(dst, `"}`...), nil
+	case bsony.Timestamp:
+		dst = append(dst, `{"$timestamp":{"t":`...)
+		dst = strconv.AppendUint(dst, uint64(x.T), 10)
+		dst = append(dst, `,"i":`...)
+		dst = strconv.AppendUint(dst, uint64(x.I), 10)
+		return append(dst, "}}"...), nil
+	case int64:
+		if !canonical {
+			return strconv.AppendInt(dst, x, 10), nil
+		}
+		dst = append(dst, `{"$numberLong":"`...)
+		dst = strconv.AppendInt(dst, x, 10)
+		return append(dst, `"}`...), nil
+	case bsony.Decimal128:
+		dst = append(dst, `{"$numberDecimal":"`...)
+		dst = append(dst, x.String()...)
+		return append(dst, `"}`...), nil
+	case bsony.MinKey:
+		return append(dst, `{"$minKey":1}`...), nil
+	case bsony.MaxKey:
+		return append(dst, `{"$maxKey":1}`...), nil
+	default:
+		return dst, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+func appendOID(dst []byte, oid bsony.ObjectID) []byte {
+	dst = append(dst, `{"$oid":"`...)
+	dst = append(dst, oid.Hex()...)
+	return append(dst, `"}`...)
+}
+
+// formatDouble formats a float64 following the Extended JSON conventions:
+// the shortest representation that round trips, always with a decimal point
+// or exponent, and named non-finite values.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	if !strings.ContainsAny(s, ".E") {
+		s += ".0"
+	}
+	return s
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string.  Invalid UTF-8 is
+// replaced with U+FFFD.
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\uFFFD"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
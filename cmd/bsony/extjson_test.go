@@ -0,0 +1,89 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+var testDir = "../../testdata/bson-corpus"
+
+type validCase struct {
+	Description      string
+	CanonicalBSON    string `json:"canonical_bson"`
+	CanonicalExtJSON string `json:"canonical_extjson"`
+	RelaxedExtJSON   string `json:"relaxed_extjson"`
+}
+
+type corpusData struct {
+	Valid []validCase
+}
+
+// TestExtJSONCorpus checks that canonical BSON renders as the corpus
+// canonical Extended JSON, and as relaxed Extended JSON where the corpus
+// provides it.  Output is compared after parsing so
+// that whitespace and key order differences don't matter.
+func TestExtJSONCorpus(t *testing.T) {
+	files, err := ioutil.ReadDir(testDir)
+	if err != nil {
+		t.Fatal("couldn't read corpus directory")
+	}
+	for _, f := range files {
+		if f.IsDir() || path.Ext(f.Name()) != ".json" {
+			continue
+		}
+		guts, err := ioutil.ReadFile(path.Join(testDir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases := &corpusData{}
+		if err := json.Unmarshal(guts, cases); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases.Valid {
+			c := c
+			t.Run(f.Name()+"/"+c.Description, func(t *testing.T) {
+				checkExtJSON(t, c.CanonicalBSON, c.CanonicalExtJSON, true)
+				if c.RelaxedExtJSON != "" {
+					checkExtJSON(t, c.CanonicalBSON, c.RelaxedExtJSON, false)
+				}
+			})
+		}
+	}
+}
+
+func checkExtJSON(t *testing.T, bsonHex string, want string, canonical bool) {
+	t.Helper()
+	raw, err := hex.DecodeString(bsonHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := fct.NewDocFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := appendExtJSONDoc(nil, d, canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotVal, wantVal interface{}
+	if err := json.Unmarshal(got, &gotVal); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &wantVal); err != nil {
+		t.Fatalf("corpus JSON is invalid: %v", err)
+	}
+	if !reflect.DeepEqual(gotVal, wantVal) {
+		t.Errorf("Extended JSON (canonical=%v) incorrect.\nGot:  %s\nWant: %s", canonical, got, want)
+	}
+}
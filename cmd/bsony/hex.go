@@ -0,0 +1,175 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/xdg-go/bsony"
+)
+
+// hexBytesPerLine is the maximum number of bytes shown on one line of a hex
+// dump; longer fields continue on following lines.
+const hexBytesPerLine = 16
+
+func runHex(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("hex", flag.ExitOnError)
+	flags.Parse(args)
+
+	return eachInput(flags.Args(), func(name string, r io.Reader) error {
+		// The hex dump must cope with corrupt framing, so it splits the
+		// input itself rather than reading documents with the library.
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		for i, base := 0, 0; base < len(data); i++ {
+			chunk := data[base:]
+			if len(chunk) >= 4 {
+				n := int(int32(binary.LittleEndian.Uint32(chunk)))
+				if n >= 5 && n <= len(chunk) {
+					chunk = chunk[:n]
+				}
+			}
+			fmt.Fprintf(stdout, "# %s: document %d\n", name, i)
+			h := &hexDumper{w: stdout}
+			// The document takes ownership of its buffer, so give it a copy.
+			d, err := fct.NewDocFromBytes(append([]byte(nil), chunk...))
+			if err != nil {
+				h.fail(base, chunk, 0, err)
+			} else {
+				h.doc(d.BytesUnsafe(), d.Iter(), base, 0)
+				d.Release()
+			}
+			base += len(chunk)
+		}
+		return nil
+	})
+}
+
+// A hexDumper writes an annotated hex dump, one field per line, in the
+// spirit of the bsonview tool in the BSON corpus.  Dumping continues as far
+// as the library can parse and marks the point where parsing fails.
+type hexDumper struct {
+	w io.Writer
+}
+
+func (h *hexDumper) line(offset int, b []byte, depth int, note string) {
+	indent := strings.Repeat("  ", depth)
+	for {
+		n := len(b)
+		if n > hexBytesPerLine {
+			n = hexBytesPerLine
+		}
+		fmt.Fprintf(h.w, "%08x  %-32s  %s%s\n", offset, hex.EncodeToString(b[:n]), indent, note)
+		b = b[n:]
+		offset += n
+		note = ""
+		if len(b) == 0 {
+			return
+		}
+	}
+}
+
+// fail dumps the bytes from the point where parsing failed.  Offsets in a
+// DecodeError are relative to the innermost document, so only the
+// underlying error is shown.
+func (h *hexDumper) fail(offset int, b []byte, depth int, err error) {
+	var de *bsony.DecodeError
+	if errors.As(err, &de) {
+		err = de.Err
+	}
+	if len(b) == 0 {
+		h.line(offset, b, depth, "!! "+err.Error())
+		return
+	}
+	h.line(offset, b, depth, "!! "+err.Error()+"; remaining bytes")
+}
+
+// An elemIter is the part of DocIter and ArrayIter used for dumping.
+type elemIter interface {
+	Next() bool
+	Type() bsony.Type
+	ValueUnsafe() bsony.Value
+	Err() error
+}
+
+// doc dumps the elements of the document or array in buf, which starts at
+// offset in the input.  The element offsets follow from the key and value
+// lengths reported by iter.  It returns false if an element could not be
+// parsed.
+func (h *hexDumper) doc(buf []byte, iter elemIter, offset, depth int) bool {
+	h.line(offset, buf[:4], depth, fmt.Sprintf("document length %d", len(buf)))
+	pos := 4
+	for iter.Next() {
+		h.line(offset+pos, buf[pos:pos+1], depth+1, "type "+iter.Type().String())
+		key := buf[pos+1 : pos+1+bytes.IndexByte(buf[pos+1:], 0)]
+		h.line(offset+pos+1, buf[pos+1:pos+len(key)+2], depth+1, "key "+strconv.Quote(string(key)))
+		pos += len(key) + 2
+		v := iter.ValueUnsafe()
+		if err := v.Err(); err != nil {
+			h.fail(offset+pos, buf[pos:], depth+1, err)
+			return false
+		}
+		if !h.value(v, buf[pos:pos+v.Len()], offset+pos, depth+1) {
+			return false
+		}
+		pos += v.Len()
+	}
+	if pos != len(buf)-1 {
+		h.fail(offset+pos, buf[pos:], depth+1, iter.Err())
+		return false
+	}
+	h.line(offset+pos, buf[pos:], depth, "end of document")
+	return true
+}
+
+// value dumps v, whose bytes are buf.  Nested documents are dumped element by
+// element through views; other values are shown on one line.
+func (h *hexDumper) value(v bsony.Value, buf []byte, offset, depth int) bool {
+	views := v.(bsony.Viewer)
+	switch v.Type() {
+	case bsony.TypeEmbeddedDocument:
+		sub, err := views.DocUnsafe()
+		if err != nil {
+			h.fail(offset, buf, depth, err)
+			return false
+		}
+		return h.doc(buf, sub.Iter(), offset, depth)
+	case bsony.TypeArray:
+		sub, err := views.ArrayUnsafe()
+		if err != nil {
+			h.fail(offset, buf, depth, err)
+			return false
+		}
+		return h.doc(buf, sub.Iter(), offset, depth)
+	case bsony.TypeCodeWithScope:
+		cs, err := views.CodeScopeUnsafe()
+		if err != nil {
+			h.fail(offset, buf, depth, err)
+			return false
+		}
+		h.line(offset, buf[:4], depth, fmt.Sprintf("code with scope length %d", len(buf)))
+		strEnd := 8 + len(cs.Code) + 1
+		h.line(offset+4, buf[4:8], depth, fmt.Sprintf("string length %d", len(cs.Code)+1))
+		h.line(offset+8, buf[8:strEnd], depth, strconv.Quote(cs.Code))
+		return h.doc(buf[strEnd:], cs.Scope.Iter(), offset+strEnd, depth)
+	}
+	if len(buf) > 0 {
+		h.line(offset, buf, depth, fmt.Sprint(v))
+	}
+	return true
+}
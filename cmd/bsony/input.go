@@ -0,0 +1,72 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xdg-go/bsony"
+)
+
+var fct = bsony.New()
+
+// A docFunc is called for each document read from the inputs.  The loc
+// argument describes where the document came from for use in messages.  If
+// the document could not be read, d is nil and err describes the problem;
+// no further documents are read from that input.
+type docFunc func(loc string, d *bsony.Doc, err error) error
+
+// eachInput opens each named file in turn (or standard input for "-" or an
+// empty list) and passes it to fn.
+func eachInput(names []string, fn func(name string, r io.Reader) error) error {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		if name == "-" {
+			if err := fn("<stdin>", bufio.NewReader(os.Stdin)); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = fn(name, bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachDoc reads concatenated documents from the named inputs and calls fn for
+// each one.  Documents are released after fn returns.
+func eachDoc(names []string, fn docFunc) error {
+	return eachInput(names, func(name string, r io.Reader) error {
+		for i := 0; ; i++ {
+			loc := fmt.Sprintf("%s: document %d", name, i)
+			d, err := fct.NewDocFromReader(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fn(loc, nil, err)
+			}
+			err = fn(loc, d, nil)
+			d.Release()
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Command bsony inspects BSON documents.  It reads single documents or
+// concatenated document streams (e.g. mongodump `.bson` files) from files or
+// standard input.
+//
+// Usage:
+//
+//	bsony dump [-format canonical|relaxed|tree] [file ...]
+//	bsony validate [file ...]
+//	bsony stats [-top n] [file ...]
+//	bsony hex [file ...]
+//
+// If no files are given, or a file is "-", standard input is read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"dump", "print documents as extended JSON or a debug tree", runDump},
+	{"validate", "report the offset and path of corrupt data", runValidate},
+	{"stats", "print type counts, nesting depth and largest fields", runStats},
+	{"hex", "print an annotated hex dump of documents", runHex},
+}
+
+// errInvalid signals that a command found invalid documents and has already
+// reported them, so bsony should exit non-zero without printing anything else.
+var errInvalid = fmt.Errorf("invalid documents found")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(runCommand(flag.Arg(0), flag.Args()[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand runs the named command and returns the exit status.
+func runCommand(name string, args []string, stdout, stderr io.Writer) int {
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(args, stdout)
+		switch {
+		case err == errInvalid:
+			return 1
+		case err != nil:
+			fmt.Fprintf(stderr, "bsony %s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "bsony: unknown command %q\n", name)
+	usage()
+	return 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: bsony <command> [flags] [file ...]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nWith no files, or when a file is \"-\", standard input is read.\n")
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xdg-go/bsony"
+)
+
+type fieldSize struct {
+	loc  string
+	path string
+	t    bsony.Type
+	size int
+}
+
+type docStats struct {
+	docs     int
+	bytes    int
+	maxDoc   int
+	maxDepth int
+	types    map[bsony.Type]int
+	largest  []fieldSize // sorted by descending size, at most top entries
+	top      int
+}
+
+// addField records a field if it is among the largest seen so far.
+func (s *docStats) addField(f fieldSize) {
+	if s.top <= 0 {
+		return
+	}
+	if len(s.largest) == s.top && f.size <= s.largest[len(s.largest)-1].size {
+		return
+	}
+	i := sort.Search(len(s.largest), func(i int) bool { return s.largest[i].size < f.size })
+	s.largest = append(s.largest, fieldSize{})
+	copy(s.largest[i+1:], s.largest[i:])
+	s.largest[i] = f
+	if len(s.largest) > s.top {
+		s.largest = s.largest[:s.top]
+	}
+}
+
+func runStats(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	top := flags.Int("top", 10, "number of largest fields to report")
+	flags.Parse(args)
+
+	s := &docStats{types: make(map[bsony.Type]int), top: *top}
+	err := eachDoc(flags.Args(), func(loc string, d *bsony.Doc, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %v", loc, err)
+		}
+		s.docs++
+		s.bytes += d.Len()
+		if d.Len() > s.maxDoc {
+			s.maxDoc = d.Len()
+		}
+		err = walkErr(d, func(path []string, v bsony.Value) bsony.WalkAction {
+			s.types[v.Type()]++
+			if len(path) > s.maxDepth {
+				s.maxDepth = len(path)
+			}
+			s.addField(fieldSize{loc: loc, path: strings.Join(path, "."), t: v.Type(), size: v.Len()})
+			return bsony.WalkContinue
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", loc, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.print(stdout)
+	return nil
+}
+
+func (s *docStats) print(w io.Writer) {
+	fmt.Fprintf(w, "documents:     %d\n", s.docs)
+	fmt.Fprintf(w, "total bytes:   %d\n", s.bytes)
+	fmt.Fprintf(w, "largest doc:   %d\n", s.maxDoc)
+	fmt.Fprintf(w, "max depth:     %d\n", s.maxDepth)
+
+	types := make([]bsony.Type, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if s.types[types[i]] != s.types[types[j]] {
+			return s.types[types[i]] > s.types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	fmt.Fprintf(w, "\ntypes:\n")
+	for _, t := range types {
+		fmt.Fprintf(w, "  %-20s %d\n", t, s.types[t])
+	}
+
+	if len(s.largest) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nlargest fields:\n")
+	for _, f := range s.largest {
+		fmt.Fprintf(w, "  %10d  %-20s %s (%s)\n", f.size, f.t, f.path, f.loc)
+	}
+}
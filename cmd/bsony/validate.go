@@ -0,0 +1,61 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/xdg-go/bsony"
+)
+
+func runValidate(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	quiet := flags.Bool("q", false, "only report invalid documents")
+	flags.Parse(args)
+
+	var total, invalid int
+	err := eachDoc(flags.Args(), func(loc string, d *bsony.Doc, err error) error {
+		total++
+		if err == nil {
+			err = walkErr(d, func([]string, bsony.Value) bsony.WalkAction { return bsony.WalkContinue })
+		}
+		if err != nil {
+			invalid++
+			fmt.Fprintf(stdout, "%s: invalid: %v\n", loc, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !*quiet {
+		fmt.Fprintf(stdout, "%d documents, %d invalid\n", total, invalid)
+	}
+	if invalid > 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// walkErr walks d with bsony.Walk.  A parse error is reported with the
+// offset of the element that couldn't be parsed and its path, or <top> for
+// the document itself.
+func walkErr(d *bsony.Doc, fn bsony.WalkFunc) error {
+	err := bsony.Walk(d, fn)
+	var de *bsony.DecodeError
+	if !errors.As(err, &de) {
+		return err
+	}
+	path := de.Path
+	if path == "" {
+		path = "<top>"
+	}
+	return fmt.Errorf("offset %d, path %s: %w", de.Offset, path, de.Err)
+}
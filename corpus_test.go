@@ -84,7 +84,7 @@ func testValidCase(t *testing.T, c validCase, k string) {
 	cB := strings.ToLower(c.CanonicalBSON)
 	cB2 := strings.ToLower(BSONToBSON(t, cB))
 	if cB != cB2 {
-		t.Errorf("native_to_bson( bson_to_native(cB) ) != cB\n Got: %s\nWant: %s", cB2, cB)
+		t.Errorf("native_to_bson( bson_to_native(cB) ) != cB\n Got: %s\nWant: %s\n Got:\n%sWant:\n%s", cB2, cB, debugHex(cB2), debugHex(cB))
 	}
 }
 
@@ -95,7 +95,7 @@ func testErrorCase(t *testing.T, c errorCase) {
 		return
 	}
 
-	err = visitDoc(t, doc)
+	err = Walk(doc, func([]string, Value) WalkAction { return WalkContinue })
 	if err != nil {
 		return
 	}
@@ -103,66 +103,6 @@ func testErrorCase(t *testing.T, c errorCase) {
 	t.Fatal("expected error, but got none")
 }
 
-func visitDoc(t *testing.T, d *Doc) error {
-	iter := d.Iter()
-	for iter.Next() {
-		if iter.Err() != nil {
-			return iter.Err()
-		}
-		switch iter.Type() {
-		case TypeEmbeddedDocument:
-			d, _ := iter.ValueUnsafe().Get().(*Doc)
-			err := visitDoc(t, d)
-			if err != nil {
-				return err
-			}
-		case TypeArray:
-			a, _ := iter.ValueUnsafe().Get().(*Array)
-			err := visitArray(t, a)
-			if err != nil {
-				return err
-			}
-		case TypeCodeWithScope:
-			cs, _ := iter.ValueUnsafe().Get().(CodeWithScope)
-			err := visitDoc(t, cs.Scope)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
-func visitArray(t *testing.T, a *Array) error {
-	iter := a.Iter()
-	for iter.Next() {
-		if iter.Err() != nil {
-			return iter.Err()
-		}
-		switch iter.Type() {
-		case TypeEmbeddedDocument:
-			d, _ := iter.ValueUnsafe().Get().(*Doc)
-			err := visitDoc(t, d)
-			if err != nil {
-				return err
-			}
-		case TypeArray:
-			a, _ := iter.ValueUnsafe().Get().(*Array)
-			err := visitArray(t, a)
-			if err != nil {
-				return err
-			}
-		case TypeCodeWithScope:
-			cs, _ := iter.ValueUnsafe().Get().(CodeWithScope)
-			err := visitDoc(t, cs.Scope)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
 func docFromHex(t *testing.T, s string) (*Doc, error) {
 	t.Helper()
 	raw, err := hex.DecodeString(s)
@@ -0,0 +1,145 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DebugString returns an annotated breakdown of the document's encoding, one
+// element per line, showing offsets, length prefixes, type bytes, keys and
+// decoded scalar values, with nested documents indented.  If an element
+// can't be parsed, the breakdown stops there and the error is marked with
+// "!!".
+func (d *Doc) DebugString() string {
+	if !d.valid {
+		return fmt.Sprintf("invalid document: %v\n", d.err)
+	}
+	var sb strings.Builder
+	writeDebugDoc(&sb, d.factory, d.buf, 0, 0)
+	return sb.String()
+}
+
+// Format implements fmt.Formatter.  The 'v' and 's' verbs print the mongo
+// shell style String form; '+v' prints the DebugString breakdown; 'q' prints
+// the String form quoted; 'x' and 'X' print the encoded document as
+// hexadecimal.
+func (d *Doc) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			io.WriteString(s, d.DebugString())
+			return
+		}
+		io.WriteString(s, d.String())
+	case 's':
+		io.WriteString(s, d.String())
+	case 'q':
+		fmt.Fprintf(s, "%q", d.String())
+	case 'x', 'X':
+		fmt.Fprintf(s, "%"+string(verb), d.buf)
+	default:
+		fmt.Fprintf(s, "%%!%c(*bsony.Doc=%s)", verb, d.String())
+	}
+}
+
+// writeDebugDoc writes the breakdown of buf, which starts at offset base in
+// the top-level document.  It returns false if parsing stopped early.
+func writeDebugDoc(w io.Writer, f *Factory, buf []byte, base int, depth int) bool {
+	indent := strings.Repeat("  ", depth)
+	if len(buf) < 5 {
+		fmt.Fprintf(w, "%04x %s!! parse stopped: %v\n", base, indent, ErrShortDoc)
+		return false
+	}
+	fmt.Fprintf(w, "%04x %s%x length %d {\n", base, indent, buf[0:4], len(buf))
+
+	d := &Doc{factory: f, buf: buf, valid: true, immutable: true}
+	iter := d.Iter()
+	for iter.Next() {
+		offset := base + iter.offset
+		fmt.Fprintf(w, "%04x %s  %02x %s %q", offset, indent, byte(iter.Type()), iter.Type(), iter.Key())
+		vu := iter.vu
+		if vu.err != nil {
+			// The offset, type and key are already shown.
+			fmt.Fprintf(w, "\n%04x %s  !! parse stopped: %v\n", offset, indent, errors.Unwrap(vu.err))
+			return false
+		}
+		// Value data begins after type byte, key and null byte.
+		dataOffset := offset + iter.keyLen + 2
+		switch vu.t {
+		case TypeEmbeddedDocument, TypeArray:
+			io.WriteString(w, "\n")
+			if !checkDebugDepth(w, f, dataOffset, depth) {
+				return false
+			}
+			if !writeDebugDoc(w, f, vu.data, dataOffset, depth+2) {
+				return false
+			}
+		case TypeCodeWithScope:
+			strLen, _ := readInt32(vu.data, 4)
+			fmt.Fprintf(w, " length %d code %q scope\n", len(vu.data), vu.data[8:8+strLen-1])
+			if !checkDebugDepth(w, f, dataOffset, depth) {
+				return false
+			}
+			if !writeDebugDoc(w, f, vu.data[8+strLen:], dataOffset+8+int(strLen), depth+2) {
+				return false
+			}
+		default:
+			fmt.Fprintf(w, " = %s\n", debugScalar(vu))
+		}
+	}
+	// DocIter leaves the offset at the terminating null byte.
+	fmt.Fprintf(w, "%04x %s} 00\n", base+iter.offset, indent)
+	return true
+}
+
+// checkDebugDepth marks where the breakdown stops and returns false if the
+// elements of a container at offset, in a document indented by depth, would
+// exceed the maximum depth of f.
+func checkDebugDepth(w io.Writer, f *Factory, offset int, depth int) bool {
+	// Each level is indented by two steps, and top-level elements are at
+	// depth 1, so the container's elements are at depth/2 + 2.
+	if err := f.limits.checkDepth(depth/2 + 2); err != nil {
+		fmt.Fprintf(w, "%04x %s    !! parse stopped: %v\n", offset, strings.Repeat("  ", depth), err)
+		return false
+	}
+	return true
+}
+
+// debugScalar describes a non-container value and its length prefix, if it
+// has one.
+func debugScalar(v *unsafeValue) string {
+	switch x := v.Get().(type) {
+	case string:
+		return fmt.Sprintf("(length %d) %q", len(x)+1, x)
+	case JavaScript:
+		return fmt.Sprintf("(length %d) %q", len(x)+1, string(x))
+	case Symbol:
+		return fmt.Sprintf("(length %d) %q", len(x)+1, string(x))
+	case Binary:
+		return fmt.Sprintf("(length %d) subtype 0x%02x data %s", len(v.data)-5, x.Subtype, hex.EncodeToString(x.Data))
+	case DBPointer:
+		return fmt.Sprintf("(length %d) %q %s", len(x.DB)+1, x.DB, x.Pointer.Hex())
+	case Regex:
+		return fmt.Sprintf("/%s/%s", x.Pattern, x.Options)
+	case ObjectID:
+		return x.Hex()
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	case Timestamp:
+		return fmt.Sprintf("t=%d i=%d", x.T, x.I)
+	case Undefined, MinKey, MaxKey, nil:
+		return v.t.String()
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
@@ -0,0 +1,65 @@
+package bsony
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestDebugString(t *testing.T) {
+	fct := New()
+
+	cases := []struct {
+		label string
+		src   string
+		want  string
+	}{
+		{
+			label: "nested",
+			src:   "2b000000106100010000000362001c00000002630002000000780004617272000900000008300001000000",
+			want: `0000 2b000000 length 43 {
+0004   10 32-bit integer "a" = 1
+000b   03 embedded document "b"
+000e     1c000000 length 28 {
+0012       02 string "c" = (length 2) "x"
+001b       04 array "arr"
+0020         09000000 length 9 {
+0024           08 boolean "0" = true
+0028         } 00
+0029     } 00
+002a } 00
+`,
+		},
+		{
+			label: "parse error",
+			src:   "1400000003780007000000107900010000000000",
+			want: `0000 14000000 length 20 {
+0004   03 embedded document "x"
+0007     07000000 length 7 {
+000b       10 32-bit integer "y"
+000b       !! parse stopped: not enough bytes available to read value
+`,
+		},
+	}
+
+	for _, c := range cases {
+		buf, err := hex.DecodeString(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := fct.NewDocFromBytes(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := doc.DebugString(); got != c.want {
+			t.Errorf("%s: incorrect debug string.\nGot:\n%s\nWant:\n%s", c.label, got, c.want)
+		}
+		if got := fmt.Sprintf("%+v", doc); got != c.want {
+			t.Errorf("%s: incorrect %%+v output.\nGot:\n%s\nWant:\n%s", c.label, got, c.want)
+		}
+		if got := fmt.Sprintf("%x", doc); got != c.src {
+			t.Errorf("%s: incorrect %%x output.\nGot:  %s\nWant: %s", c.label, got, c.src)
+		}
+		doc.Release()
+	}
+}
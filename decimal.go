@@ -0,0 +1,542 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A Decimal128 is an IEEE 754-2008 128-bit decimal floating point number in
+// the binary integer decimal (BID) encoding used by BSON.  It holds up to 34
+// significant digits with exponents from -6176 to 6111.  The zero value is
+// positive zero.
+//
+// Arithmetic methods round half-to-even to 34 digits, as IEEE 754-2008
+// requires by default; results too large to represent become infinite.
+type Decimal128 struct {
+	h, l uint64
+}
+
+const (
+	decimal128Digits = 34
+	decimal128Bias   = 6176
+	decimal128MinExp = -6176
+	decimal128MaxExp = 6111
+
+	decimal128SignBit = 1 << 63
+	decimal128InfHigh = 0x7800000000000000
+	decimal128NaNHigh = 0x7C00000000000000
+)
+
+var errDecimal128Syntax = errors.New("invalid decimal128 string")
+var errDecimal128Inexact = errors.New("decimal128 string can't be represented without rounding")
+var errDecimal128Overflow = errors.New("decimal128 exponent out of range")
+var errDecimal128NotFinite = errors.New("decimal128 value is NaN or infinite")
+
+var bigTen = big.NewInt(10)
+var bigMaxCoefficient = new(big.Int).Sub(new(big.Int).Exp(bigTen, big.NewInt(decimal128Digits), nil), big.NewInt(1))
+var bigMask64 = new(big.Int).SetUint64(^uint64(0))
+
+// NewDecimal128 returns a Decimal128 from its high and low 64-bit halves.
+func NewDecimal128(h, l uint64) Decimal128 {
+	return Decimal128{h: h, l: l}
+}
+
+// GetBytes returns the high and low 64-bit halves of the encoding.
+func (d Decimal128) GetBytes() (uint64, uint64) {
+	return d.h, d.l
+}
+
+// IsNaN reports whether d is a (quiet or signaling) NaN.
+func (d Decimal128) IsNaN() bool {
+	return d.h&decimal128NaNHigh == decimal128NaNHigh
+}
+
+// IsInf returns 1 if d is positive infinity, -1 if d is negative infinity
+// and 0 otherwise.
+func (d Decimal128) IsInf() int {
+	if d.h&decimal128NaNHigh != decimal128InfHigh {
+		return 0
+	}
+	if d.h&decimal128SignBit != 0 {
+		return -1
+	}
+	return 1
+}
+
+// Neg returns d with its sign reversed.
+func (d Decimal128) Neg() Decimal128 {
+	return Decimal128{h: d.h ^ decimal128SignBit, l: d.l}
+}
+
+// decimalParts is an unpacked Decimal128.  For finite values, the value is
+// coef * 10^exp, negated if neg is true.  The coefficient is never negative.
+type decimalParts struct {
+	neg  bool
+	nan  bool
+	inf  bool
+	coef *big.Int
+	exp  int
+}
+
+func (d Decimal128) parts() decimalParts {
+	p := decimalParts{neg: d.h&decimal128SignBit != 0, coef: new(big.Int)}
+	switch {
+	case d.IsNaN():
+		p.nan = true
+	case d.IsInf() != 0:
+		p.inf = true
+	case (d.h>>61)&3 == 3:
+		// The "11" combination field form implies a coefficient of at least
+		// 2^113, which exceeds 34 digits, so the value is non-canonical and
+		// treated as zero.
+		p.exp = int((d.h>>47)&0x3fff) - decimal128Bias
+	default:
+		p.exp = int((d.h>>49)&0x3fff) - decimal128Bias
+		p.coef.SetUint64(d.h & (1<<49 - 1))
+		p.coef.Lsh(p.coef, 64)
+		p.coef.Or(p.coef, new(big.Int).SetUint64(d.l))
+		if p.coef.Cmp(bigMaxCoefficient) > 0 {
+			p.coef.SetInt64(0)
+		}
+	}
+	return p
+}
+
+// String returns d in the scientific string format of IEEE 754-2008, as
+// used for Extended JSON.  Numbers with a non-positive exponent and an
+// adjusted exponent of at least -6 are written without an exponent.
+func (d Decimal128) String() string {
+	p := d.parts()
+	if p.nan {
+		return "NaN"
+	}
+	var sb strings.Builder
+	if p.neg {
+		sb.WriteByte('-')
+	}
+	if p.inf {
+		sb.WriteString("Infinity")
+		return sb.String()
+	}
+
+	digits := p.coef.String()
+	adjusted := p.exp + len(digits) - 1
+	switch {
+	case p.exp <= 0 && adjusted >= -6:
+		n := len(digits) + p.exp
+		switch {
+		case p.exp == 0:
+			sb.WriteString(digits)
+		case n > 0:
+			sb.WriteString(digits[:n])
+			sb.WriteByte('.')
+			sb.WriteString(digits[n:])
+		default:
+			sb.WriteString("0.")
+			sb.WriteString(strings.Repeat("0", -n))
+			sb.WriteString(digits)
+		}
+	default:
+		sb.WriteByte(digits[0])
+		if len(digits) > 1 {
+			sb.WriteByte('.')
+			sb.WriteString(digits[1:])
+		}
+		sb.WriteByte('E')
+		if adjusted >= 0 {
+			sb.WriteByte('+')
+		}
+		sb.WriteString(strconv.Itoa(adjusted))
+	}
+	return sb.String()
+}
+
+// ParseDecimal128 parses a decimal string such as "1.5", "-2E+10", "NaN" or
+// "Infinity" (case-insensitive, optionally abbreviated "Inf").  Values that
+// can't be represented exactly, because they need more than 34 significant
+// digits or an exponent out of range, are errors.  Trailing zeros are
+// dropped, or zeros appended (clamping), as needed to fit an exact value.
+func ParseDecimal128(s string) (Decimal128, error) {
+	return parseDecimal128(s, true)
+}
+
+func parseDecimal128(s string, exact bool) (Decimal128, error) {
+	p, err := parseDecimalString(s)
+	if err != nil {
+		return Decimal128{}, err
+	}
+	if p.nan || p.inf {
+		return p.special(), nil
+	}
+	d, isExact, overflow := newDecimal128(p.neg, p.coef, p.exp)
+	if overflow {
+		return Decimal128{}, fmt.Errorf("%w: %q", errDecimal128Overflow, s)
+	}
+	if exact && !isExact {
+		return Decimal128{}, fmt.Errorf("%w: %q", errDecimal128Inexact, s)
+	}
+	return d, nil
+}
+
+func parseDecimalString(s string) (decimalParts, error) {
+	var p decimalParts
+	syntaxErr := fmt.Errorf("%w: %q", errDecimal128Syntax, s)
+
+	i := 0
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		p.neg = s[0] == '-'
+		i++
+	}
+	switch strings.ToLower(s[i:]) {
+	case "inf", "infinity":
+		p.inf = true
+		return p, nil
+	case "nan":
+		p.nan = true
+		return p, nil
+	}
+
+	var digits []byte
+	var sawDot bool
+	var fracDigits int
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '.' {
+			if sawDot {
+				return p, syntaxErr
+			}
+			sawDot = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+		digits = append(digits, c)
+		if sawDot {
+			fracDigits++
+		}
+	}
+	if len(digits) == 0 {
+		return p, syntaxErr
+	}
+
+	exp := 0
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		expNeg := false
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			expNeg = s[i] == '-'
+			i++
+		}
+		start := i
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			// Saturate huge exponents; they overflow or underflow anyway.
+			if exp < 1e9 {
+				exp = exp*10 + int(s[i]-'0')
+			}
+		}
+		if i == start {
+			return p, syntaxErr
+		}
+		if expNeg {
+			exp = -exp
+		}
+	}
+	if i != len(s) {
+		return p, syntaxErr
+	}
+
+	p.coef = new(big.Int)
+	if trimmed := strings.TrimLeft(string(digits), "0"); trimmed != "" {
+		p.coef.SetString(trimmed, 10)
+	}
+	p.exp = exp - fracDigits
+	return p, nil
+}
+
+// special returns the Decimal128 for a NaN or infinite decimalParts.
+func (p decimalParts) special() Decimal128 {
+	var d Decimal128
+	if p.nan {
+		d.h = decimal128NaNHigh
+	} else {
+		d.h = decimal128InfHigh
+	}
+	if p.neg {
+		d.h |= decimal128SignBit
+	}
+	return d
+}
+
+// newDecimal128 rounds coef * 10^exp half-to-even to fit a Decimal128.  It
+// reports whether the result is exact and whether it overflowed, in which
+// case the result is infinite.
+func newDecimal128(neg bool, coef *big.Int, exp int) (Decimal128, bool, bool) {
+	c := new(big.Int).Set(coef)
+	exact := true
+
+	// Round once, by whichever is larger of the excess digits and the
+	// exponent underflow, so subnormal results aren't rounded twice.
+	shift := numDigits(c) - decimal128Digits
+	if decimal128MinExp-exp > shift {
+		shift = decimal128MinExp - exp
+	}
+	if shift > 0 {
+		exact = roundShift(c, shift)
+		exp += shift
+		if c.Cmp(bigMaxCoefficient) > 0 {
+			// Rounding carried to 35 digits; the last digit is zero.
+			c.Quo(c, bigTen)
+			exp++
+		}
+	}
+
+	if exp > decimal128MaxExp {
+		if c.Sign() == 0 {
+			exp = decimal128MaxExp
+		} else {
+			// Clamp by scaling the coefficient, if there's room.
+			pad := exp - decimal128MaxExp
+			if pad > decimal128Digits-numDigits(c) {
+				return decimalParts{neg: neg, inf: true}.special(), false, true
+			}
+			c.Mul(c, pow10(pad))
+			exp = decimal128MaxExp
+		}
+	}
+
+	d := Decimal128{
+		h: uint64(exp+decimal128Bias)<<49 | new(big.Int).Rsh(c, 64).Uint64(),
+		l: new(big.Int).And(c, bigMask64).Uint64(),
+	}
+	if neg {
+		d.h |= decimal128SignBit
+	}
+	return d, exact, false
+}
+
+// roundShift divides c by 10^shift in place, rounding half-to-even, and
+// reports whether no non-zero digits were discarded.
+func roundShift(c *big.Int, shift int) bool {
+	if c.Sign() == 0 {
+		return true
+	}
+	// Beyond one more than the digit count, the quotient rounds to zero
+	// and we avoid computing huge powers of ten.
+	if n := numDigits(c); shift > n+1 {
+		c.SetInt64(0)
+		return false
+	}
+	divisor := pow10(shift)
+	r := new(big.Int)
+	c.QuoRem(c, divisor, r)
+	if r.Sign() == 0 {
+		return true
+	}
+	switch r.Lsh(r, 1).Cmp(divisor) {
+	case 1:
+		c.Add(c, big.NewInt(1))
+	case 0:
+		if c.Bit(0) == 1 {
+			c.Add(c, big.NewInt(1))
+		}
+	}
+	return false
+}
+
+func numDigits(c *big.Int) int {
+	if c.Sign() == 0 {
+		return 1
+	}
+	return len(c.Text(10))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// BigInt returns the signed coefficient and exponent of d, such that its
+// value is coef * 10^exp.  It returns an error if d is NaN or infinite.
+func (d Decimal128) BigInt() (*big.Int, int, error) {
+	p := d.parts()
+	if p.nan || p.inf {
+		return nil, 0, errDecimal128NotFinite
+	}
+	if p.neg {
+		p.coef.Neg(p.coef)
+	}
+	return p.coef, p.exp, nil
+}
+
+// NewDecimal128FromBigInt returns coef * 10^exp as a Decimal128, rounding
+// half-to-even to 34 significant digits if necessary.  It returns an error if
+// the value is too large to represent.
+func NewDecimal128FromBigInt(coef *big.Int, exp int) (Decimal128, error) {
+	neg := coef.Sign() < 0
+	d, _, overflow := newDecimal128(neg, new(big.Int).Abs(coef), exp)
+	if overflow {
+		return Decimal128{}, errDecimal128Overflow
+	}
+	return d, nil
+}
+
+// BigFloat returns d as a big.Float with 113 bits of precision, enough to
+// hold any Decimal128 coefficient exactly.  Values with negative exponents
+// are rounded to nearest even.  It returns an error if d is NaN.
+func (d Decimal128) BigFloat() (*big.Float, error) {
+	p := d.parts()
+	f := new(big.Float).SetPrec(113)
+	switch {
+	case p.nan:
+		return nil, errDecimal128NotFinite
+	case p.inf:
+		return f.SetInf(p.neg), nil
+	}
+	num, den := p.coef, big.NewInt(1)
+	if p.exp > 0 {
+		num.Mul(num, pow10(p.exp))
+	} else {
+		den = pow10(-p.exp)
+	}
+	f.SetRat(new(big.Rat).SetFrac(num, den))
+	if p.neg {
+		f.Neg(f)
+	}
+	return f, nil
+}
+
+// NewDecimal128FromBigFloat returns f as a Decimal128.  It uses the shortest
+// decimal that rounds back to f at f's precision, rounding half-to-even to 34
+// significant digits if that is longer.  It returns an error if the value
+// is too large to represent.
+func NewDecimal128FromBigFloat(f *big.Float) (Decimal128, error) {
+	if f.IsInf() {
+		return decimalParts{neg: f.Signbit(), inf: true}.special(), nil
+	}
+	s := f.Text('e', -1)
+	if mantissa := s[:strings.IndexByte(s, 'e')]; len(strings.Trim(mantissa, "-.")) > decimal128Digits {
+		s = f.Text('e', decimal128Digits-1)
+	}
+	return parseDecimal128(s, false)
+}
+
+// Cmp compares d and e, returning -1, 0 or +1 if d is less than, equal to or
+// greater than e.  Zeros of either sign are equal.  For a total order that
+// matches MongoDB's sorting, NaNs are equal to each other and less than all
+// other values.
+func (d Decimal128) Cmp(e Decimal128) int {
+	x, y := d.parts(), e.parts()
+	switch {
+	case x.nan || y.nan:
+		return boolCmp(!x.nan, !y.nan)
+	case x.inf || y.inf:
+		rx, ry := infRank(x), infRank(y)
+		switch {
+		case rx < ry:
+			return -1
+		case rx > ry:
+			return 1
+		}
+		return 0
+	}
+	a, b := x.signed(), y.signed()
+	alignExponents(a, x.exp, b, y.exp)
+	return a.Cmp(b)
+}
+
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// infRank orders values with infinities at the extremes; finite values are
+// all ranked zero and must be compared separately.
+func infRank(p decimalParts) int {
+	switch {
+	case p.inf && p.neg:
+		return -1
+	case p.inf:
+		return 1
+	}
+	return 0
+}
+
+func (p decimalParts) signed() *big.Int {
+	c := new(big.Int).Set(p.coef)
+	if p.neg {
+		c.Neg(c)
+	}
+	return c
+}
+
+// alignExponents scales a or b in place so both have the smaller of the two
+// exponents, which it returns.
+func alignExponents(a *big.Int, aExp int, b *big.Int, bExp int) int {
+	switch {
+	case aExp > bExp:
+		a.Mul(a, pow10(aExp-bExp))
+		return bExp
+	case bExp > aExp:
+		b.Mul(b, pow10(bExp-aExp))
+	}
+	return aExp
+}
+
+// Add returns d + e.
+func (d Decimal128) Add(e Decimal128) Decimal128 {
+	x, y := d.parts(), e.parts()
+	switch {
+	case x.nan || y.nan:
+		return decimalParts{nan: true}.special()
+	case x.inf && y.inf && x.neg != y.neg:
+		return decimalParts{nan: true}.special()
+	case x.inf:
+		return d
+	case y.inf:
+		return e
+	}
+	a, b := x.signed(), y.signed()
+	exp := alignExponents(a, x.exp, b, y.exp)
+	sum := a.Add(a, b)
+	// An exact zero sum is positive unless both operands are negative.
+	neg := sum.Sign() < 0 || (sum.Sign() == 0 && x.neg && y.neg)
+	r, _, _ := newDecimal128(neg, sum.Abs(sum), exp)
+	return r
+}
+
+// Sub returns d - e.
+func (d Decimal128) Sub(e Decimal128) Decimal128 {
+	return d.Add(e.Neg())
+}
+
+// Mul returns d * e.
+func (d Decimal128) Mul(e Decimal128) Decimal128 {
+	x, y := d.parts(), e.parts()
+	neg := x.neg != y.neg
+	switch {
+	case x.nan || y.nan:
+		return decimalParts{nan: true}.special()
+	case x.inf || y.inf:
+		if (!x.inf && x.coef.Sign() == 0) || (!y.inf && y.coef.Sign() == 0) {
+			return decimalParts{nan: true}.special()
+		}
+		return decimalParts{neg: neg, inf: true}.special()
+	}
+	r, _, _ := newDecimal128(neg, x.coef.Mul(x.coef, y.coef), x.exp+y.exp)
+	return r
+}
@@ -0,0 +1,317 @@
+package bsony
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+type decimalCorpusCase struct {
+	Description       string
+	CanonicalBSON     string `json:"canonical_bson"`
+	CanonicalExtJSON  string `json:"canonical_extjson"`
+	DegenerateBSON    string `json:"degenerate_bson"`
+	DegenerateExtJSON string `json:"degenerate_extjson"`
+}
+
+type decimalCorpus struct {
+	Valid       []decimalCorpusCase
+	ParseErrors []struct {
+		Description string
+		String      string
+	} `json:"parseErrors"`
+}
+
+// decimalFromHex extracts the decimal from a hex-encoded corpus document
+// with a single Decimal128 value.
+func decimalFromHex(t *testing.T, s string) Decimal128 {
+	t.Helper()
+	doc, err := docFromHex(t, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Release()
+	iter := doc.Iter()
+	iter.Next()
+	x, ok := iter.Get().(Decimal128)
+	if !ok {
+		t.Fatalf("value was %T, not Decimal128", iter.Get())
+	}
+	return x
+}
+
+// decimalFromExtJSON extracts the $numberDecimal string from a corpus
+// Extended JSON document.
+func decimalFromExtJSON(t *testing.T, s string) string {
+	t.Helper()
+	var doc map[string]map[string]string
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range doc {
+		return v["$numberDecimal"]
+	}
+	t.Fatalf("no value in %s", s)
+	return ""
+}
+
+func TestDecimal128Corpus(t *testing.T) {
+	files, err := filepath.Glob(path.Join(testDir, "decimal128-*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("couldn't find decimal128 corpus files")
+	}
+	for _, file := range files {
+		guts, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus := &decimalCorpus{}
+		if err := json.Unmarshal(guts, corpus); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(path.Base(file), func(t *testing.T) {
+			for _, c := range corpus.Valid {
+				t.Run("valid "+c.Description, func(t *testing.T) { testDecimalValid(t, c) })
+			}
+			for _, c := range corpus.ParseErrors {
+				if x, err := ParseDecimal128(c.String); err == nil {
+					t.Errorf("parse error %s: expected error parsing %q, got %s", c.Description, c.String, x)
+				}
+			}
+		})
+	}
+}
+
+func testDecimalValid(t *testing.T, c decimalCorpusCase) {
+	want := decimalFromHex(t, c.CanonicalBSON)
+	wantStr := decimalFromExtJSON(t, c.CanonicalExtJSON)
+
+	if got := want.String(); got != wantStr {
+		t.Errorf("String of canonical BSON incorrect.\nGot:  %s\nWant: %s", got, wantStr)
+	}
+
+	// NaN sign and payload aren't preserved in strings, and non-canonical
+	// encodings of zero parse to the canonical encoding.
+	nonCanonical := want.h&(3<<61) == 3<<61 && !want.IsNaN() && want.IsInf() == 0
+	if !want.IsNaN() && !nonCanonical {
+		got, err := ParseDecimal128(wantStr)
+		if err != nil {
+			t.Errorf("error parsing canonical string %q: %v", wantStr, err)
+		} else if got != want {
+			t.Errorf("parsing canonical string %q incorrect.\nGot:  %016x%016x\nWant: %016x%016x", wantStr, got.h, got.l, want.h, want.l)
+		}
+	}
+
+	if c.DegenerateBSON != "" {
+		x := decimalFromHex(t, c.DegenerateBSON)
+		if got := x.String(); got != wantStr {
+			t.Errorf("String of degenerate BSON incorrect.\nGot:  %s\nWant: %s", got, wantStr)
+		}
+	}
+
+	if c.DegenerateExtJSON != "" {
+		s := decimalFromExtJSON(t, c.DegenerateExtJSON)
+		got, err := ParseDecimal128(s)
+		if err != nil {
+			t.Errorf("error parsing degenerate string %q: %v", s, err)
+		} else if got != want {
+			t.Errorf("parsing degenerate string %q incorrect.\nGot:  %016x%016x\nWant: %016x%016x", s, got.h, got.l, want.h, want.l)
+		}
+	}
+}
+
+func mustDecimal(t *testing.T, s string) Decimal128 {
+	t.Helper()
+	x, err := ParseDecimal128(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestDecimal128Arithmetic(t *testing.T) {
+	cases := []struct {
+		op   string
+		x, y string
+		want string
+	}{
+		{"add", "1.5", "2.25", "3.75"},
+		{"add", "1E+3", "1", "1001"},
+		{"add", "1", "-1", "0"},
+		{"add", "-0", "-0", "-0"},
+		{"add", "-0", "0", "0"},
+		{"add", "0.00", "0.0", "0.00"},
+		{"add", "9999999999999999999999999999999999", "1", "1.000000000000000000000000000000000E+34"},
+		// Round half-to-even when the exact sum has 35 digits.
+		{"add", "1234567890123456789012345678901234", "0.5", "1234567890123456789012345678901234"},
+		{"add", "1234567890123456789012345678901235", "0.5", "1234567890123456789012345678901236"},
+		{"add", "1234567890123456789012345678901234", "0.51", "1234567890123456789012345678901235"},
+		{"add", "9.999999999999999999999999999999999E+6144", "1E+6144", "Infinity"},
+		{"add", "Infinity", "1", "Infinity"},
+		{"add", "Infinity", "-Infinity", "NaN"},
+		{"add", "NaN", "1", "NaN"},
+		{"sub", "1", "0.1", "0.9"},
+		{"sub", "1.00", "1", "0.00"},
+		{"sub", "-Infinity", "-Infinity", "NaN"},
+		{"mul", "1.5", "-2", "-3.0"},
+		{"mul", "1E-6176", "0.1", "0E-6176"},
+		{"mul", "-1E-6176", "0.5", "-0E-6176"},
+		{"mul", "1E-6176", "5", "5E-6176"},
+		{"mul", "1E+6111", "10", "1.0E+6112"},
+		{"mul", "9E+6144", "10", "Infinity"},
+		{"mul", "-Infinity", "2", "-Infinity"},
+		{"mul", "Infinity", "0", "NaN"},
+		{"mul", "1111111111111111111111111111111111", "3", "3333333333333333333333333333333333"},
+		{"mul", "1111111111111111111111111111111111", "10.5", "1.166666666666666666666666666666667E+34"},
+	}
+
+	for _, c := range cases {
+		x, y := mustDecimal(t, c.x), mustDecimal(t, c.y)
+		var got Decimal128
+		switch c.op {
+		case "add":
+			got = x.Add(y)
+		case "sub":
+			got = x.Sub(y)
+		case "mul":
+			got = x.Mul(y)
+		}
+		if got.String() != c.want {
+			t.Errorf("%s %s %s: got %s, want %s", c.x, c.op, c.y, got, c.want)
+		}
+	}
+}
+
+func TestDecimal128Cmp(t *testing.T) {
+	ordered := []string{"NaN", "-Infinity", "-1E+10", "-1.5", "-1", "0", "0.5", "1", "1.00000000001", "1E+10", "Infinity"}
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			x, y := mustDecimal(t, ordered[i]), mustDecimal(t, ordered[j])
+			if got := x.Cmp(y); got != want {
+				t.Errorf("Cmp(%s, %s): got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	equal := [][2]string{{"0", "-0"}, {"1", "1.000"}, {"1E+2", "100"}, {"NaN", "-NaN"}, {"0E-6176", "0E+6111"}}
+	for _, c := range equal {
+		x, y := mustDecimal(t, c[0]), mustDecimal(t, c[1])
+		if got := x.Cmp(y); got != 0 {
+			t.Errorf("Cmp(%s, %s): got %d, want 0", x, y, got)
+		}
+	}
+}
+
+func TestDecimal128BigInt(t *testing.T) {
+	cases := []struct {
+		s    string
+		coef string
+		exp  int
+	}{
+		{"0", "0", 0},
+		{"-1.50", "-150", -2},
+		{"1E+3", "1", 3},
+		{"9.999999999999999999999999999999999E+6144", "9999999999999999999999999999999999", 6111},
+	}
+	for _, c := range cases {
+		x := mustDecimal(t, c.s)
+		coef, exp, err := x.BigInt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if coef.String() != c.coef || exp != c.exp {
+			t.Errorf("BigInt of %s: got %s, %d, want %s, %d", c.s, coef, exp, c.coef, c.exp)
+		}
+		back, err := NewDecimal128FromBigInt(coef, exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != x {
+			t.Errorf("round trip of %s got %s", c.s, back)
+		}
+	}
+
+	if _, _, err := mustDecimal(t, "NaN").BigInt(); err == nil {
+		t.Error("expected error for BigInt of NaN")
+	}
+
+	coef, _ := new(big.Int).SetString("12345678901234567890123456789012345", 10)
+	x, err := NewDecimal128FromBigInt(coef, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.String() != "1.234567890123456789012345678901234E+34" {
+		t.Errorf("rounding from big.Int incorrect: got %s", x)
+	}
+	if _, err := NewDecimal128FromBigInt(big.NewInt(1), 7000); err == nil {
+		t.Error("expected overflow error from big.Int")
+	}
+}
+
+func TestDecimal128BigFloat(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+	}{
+		{"0", "0"},
+		{"-1.5", "-1.5"},
+		{"1E+3", "1000"},
+		{"0.1", "0.1"},
+		{"-Infinity", "-Inf"},
+	}
+	for _, c := range cases {
+		f, err := mustDecimal(t, c.s).BigFloat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Text('g', 10); got != c.want {
+			t.Errorf("BigFloat of %s: got %s, want %s", c.s, got, c.want)
+		}
+	}
+	if _, err := mustDecimal(t, "NaN").BigFloat(); err == nil {
+		t.Error("expected error for BigFloat of NaN")
+	}
+
+	fromFloat := []struct {
+		f    *big.Float
+		want string
+	}{
+		{big.NewFloat(0.1), "0.1"},
+		{big.NewFloat(-2.5e-10), "-2.5E-10"},
+		{new(big.Float).SetInf(true), "-Infinity"},
+		{new(big.Float).SetPrec(200).Quo(big.NewFloat(1), big.NewFloat(3)), "0.3333333333333333333333333333333333"},
+	}
+	for _, c := range fromFloat {
+		x, err := NewDecimal128FromBigFloat(c.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.String() != c.want {
+			t.Errorf("NewDecimal128FromBigFloat(%s): got %s, want %s", c.f, x, c.want)
+		}
+	}
+}
+
+func TestDecimal128Bytes(t *testing.T) {
+	x := mustDecimal(t, "1")
+	h, l := x.GetBytes()
+	if h != 0x3040000000000000 || l != 1 {
+		t.Errorf("GetBytes incorrect: %016x %016x", h, l)
+	}
+	if NewDecimal128(h, l) != x {
+		t.Error("NewDecimal128 didn't round trip")
+	}
+	buf, _ := hex.DecodeString("180000001364000100000000000000000000000000403000")
+	compareDocHex(t, fct.NewDoc().AddDecimal128("d", x), hex.EncodeToString(buf), "AddDecimal128")
+}
@@ -8,20 +8,14 @@ package bsony
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var errShortDoc = errors.New("not enough bytes available to read value")
-var errInvalidLength = errors.New("document length doesn't match buffer length")
-var errMissingTerminator = errors.New("document buffer missing null terminator")
-var errImmutableInvalid = errors.New("can't modify immutable or invalid document")
-var errBufferReleased = errors.New("buffer released")
+// emptyDoc is the encoding of an empty document.
+var emptyDoc = []byte{5, 0, 0, 0, 0}
 
 // A Doc object represents a BSON document
 type Doc struct {
@@ -29,6 +23,11 @@ type Doc struct {
 	buf       []byte
 	valid     bool
 	immutable bool
+	frozen    bool            // immutable and reference counted; see Freeze
+	refs      int32           // references to a frozen document
+	dbg       *docDebug       // non-nil in debug mode
+	keys      map[string]bool // keys of a large document, for duplicate checks
+	index     atomic.Value    // *keyIndex built by Index
 	err       error
 }
 
@@ -36,13 +35,13 @@ type Doc struct {
 func validateBSONFraming(buf []byte) error {
 	length, err := readInt32(buf, 0)
 	if err != nil {
-		return err
+		return &DecodeError{Err: err}
 	}
-	if len(buf) != int(length) {
-		return errInvalidLength
+	if len(buf) != int(length) || length < 5 {
+		return &DecodeError{Err: errorf(ErrInvalidLength, "document length %d doesn't match buffer length %d", length, len(buf))}
 	}
 	if buf[len(buf)-1] != 0 {
-		return errMissingTerminator
+		return &DecodeError{Offset: len(buf) - 1, Err: ErrMissingTerminator}
 	}
 	return nil
 }
@@ -53,22 +52,37 @@ func (d *Doc) Valid() bool {
 	return d.valid
 }
 
-// Err returns any error recorded on the document.
+// Err returns any error recorded on the document.  Once an Add method
+// records an error, the Add methods add nothing more.
 func (d *Doc) Err() error {
 	return d.err
 }
 
 // Release returns allocated space.  After calling this method, the document is
 // invalid.  Any prior error is replaced with a "buffer released" message.
+// Releasing an already released document has no effect.
+//
+// For a frozen document, Release drops one reference and space is returned
+// only when the last reference is released.
 func (d *Doc) Release() {
-	if d.immutable {
+	if d.frozen && atomic.AddInt32(&d.refs, -1) > 0 {
+		return
+	}
+	// A view doesn't own its buffer or the debug record it shares.
+	if d.immutable && !d.frozen {
+		return
+	}
+	d.dbg.release()
+	if !d.valid {
 		return
 	}
 	d.factory.release(d.buf)
 	d.buf = nil
+	d.keys = nil
+	d.dropIndex()
 	d.factory = nil
 	d.valid = false
-	d.err = errBufferReleased
+	d.err = ErrBufferReleased
 	return
 }
 
@@ -93,6 +107,19 @@ func (d *Doc) Len() int {
 	return len(d.buf)
 }
 
+// BytesUnsafe returns the encoded document without copying.  It returns nil
+// if the document is invalid.
+//
+// WARNING: the slice directly references the document buffer: (1) you MUST
+// NOT modify it; (2) because buffers may be reused, you MUST NOT keep it
+// beyond the lifetime of the document or past any call that adds to it.
+func (d *Doc) BytesUnsafe() []byte {
+	if !d.valid {
+		return nil
+	}
+	return d.buf
+}
+
 // grow increases the buffer size by the given amount and sets length bytes at
 // start of the document to match.
 func (d *Doc) grow(n int) {
@@ -108,6 +135,19 @@ func (d *Doc) Clone() *Doc {
 
 // Concat ..
 func (d *Doc) Concat(src *Doc) *Doc {
+	if d.factory.dupKeys != DuplicateKeysAllow || d.factory.storage {
+		// Add elements one at a time to apply the duplicate key policy and
+		// storage rules.
+		iter := src.Iter()
+		for iter.Next() {
+			d.AddValue(iter.Key(), iter.vu)
+		}
+		if iter.err != nil && d.err == nil {
+			d.err = iter.err
+		}
+		return d
+	}
+	d.dropIndex()
 	// Grow by len(src) less length bytes and null terminator byte
 	offset := len(d.buf) - 1
 	d.grow(len(src.buf) - 5)
@@ -120,7 +160,7 @@ func (d *Doc) Concat(src *Doc) *Doc {
 // XXX rethink which of these actually need pointer support? all or none?
 func (d *Doc) Add(k string, v interface{}) *Doc {
 	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+		d.err = ErrImmutable
 		return d
 	}
 
@@ -148,17 +188,17 @@ func (d *Doc) Add(k string, v interface{}) *Doc {
 		return d.AddArray(k, x)
 
 	// Type 05 - binary
-	case primitive.Binary:
+	case Binary:
 		return d.AddBinary(k, &x)
-	case *primitive.Binary:
+	case *Binary:
 		return d.AddBinary(k, x)
 
 	// Type 06 - undefined (deprecated)
-	case primitive.Undefined:
+	case Undefined:
 		return d.AddUndefined(k)
 
 	// Type 07 - ObjectID
-	case primitive.ObjectID:
+	case ObjectID:
 		return d.AddOID(k, x)
 
 	// Type 08 - boolean
@@ -166,7 +206,7 @@ func (d *Doc) Add(k string, v interface{}) *Doc {
 		return d.AddBool(k, x)
 
 	// Type 09 - UTC DateTime
-	case primitive.DateTime:
+	case DateTime:
 		return d.AddDateTime(k, x)
 	case time.Time:
 		return d.AddDateTimeFromTime(k, x)
@@ -178,47 +218,35 @@ func (d *Doc) Add(k string, v interface{}) *Doc {
 		return d.AddNull(k)
 
 	// Type 0B - regular expression
-	case primitive.Regex:
+	case Regex:
 		return d.AddRegex(k, x)
-	case *primitive.Regex:
+	case *Regex:
 		return d.AddRegex(k, *x)
 
 	// Type 0C - DBPointer (deprecated)
-	case primitive.DBPointer:
+	case DBPointer:
 		return d.AddDBPointer(k, x)
-	case *primitive.DBPointer:
+	case *DBPointer:
 		return d.AddDBPointer(k, *x)
 
 	// Type 0D - JavaScript code
-	case primitive.JavaScript:
+	case JavaScript:
 		return d.AddJavaScript(k, x)
 
 	// Type 0E - Symbol (deprecated)
-	case primitive.Symbol:
+	case Symbol:
 		return d.AddSymbol(k, x)
 
 		// Type 0F - JavaScript code with scope
 	case CodeWithScope:
 		return d.AddCodeScope(k, x)
-	case primitive.CodeWithScope:
-		buf, err := bson.Marshal(x.Scope)
-		if err != nil {
-			d.err = fmt.Errorf("error marshaling scope for key '%s': %w", k, err)
-			return d
-		}
-		scope, err := d.factory.NewDocFromBytes(buf)
-		if err != nil {
-			d.err = fmt.Errorf("error marshaling scope for key '%s': buffer invalid: %w", k, err)
-			return d
-		}
-		return d.AddCodeScope(k, CodeWithScope{Code: string(x.Code), Scope: scope})
 
 	// Type 10 - 32-bit integer
 	case int32:
 		return d.AddInt32(k, x)
 
 		// Type 11 - timestamp
-	case primitive.Timestamp:
+	case Timestamp:
 		return d.AddTimestamp(k, x)
 
 	// Type 12 - 64-bit integer
@@ -226,17 +254,17 @@ func (d *Doc) Add(k string, v interface{}) *Doc {
 		return d.AddInt64(k, x)
 
 		// Type 13 - 128-bit decimal floating point
-	case primitive.Decimal128:
+	case Decimal128:
 		return d.AddDecimal128(k, x)
-	case *primitive.Decimal128:
+	case *Decimal128:
 		return d.AddDecimal128(k, *x)
 
 	// Type FF - Min key
-	case primitive.MinKey:
+	case MinKey:
 		return d.AddMinKey(k)
 
 	// Type 7F - Max key
-	case primitive.MaxKey:
+	case MaxKey:
 		return d.AddMaxKey(k)
 
 	default:
@@ -246,8 +274,8 @@ func (d *Doc) Add(k string, v interface{}) *Doc {
 
 // AddDouble ...
 func (d *Doc) AddDouble(k string, v float64) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -256,13 +284,13 @@ func (d *Doc) AddDouble(k string, v float64) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeDouble, k)
 	writeFloat64(d.buf, offset, v)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddString ...
 func (d *Doc) AddString(k string, v string) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -271,13 +299,13 @@ func (d *Doc) AddString(k string, v string) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeString, k)
 	writeString(d.buf, offset, v)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddDoc ...
 func (d *Doc) AddDoc(k string, v *Doc) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -286,13 +314,13 @@ func (d *Doc) AddDoc(k string, v *Doc) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeEmbeddedDocument, k)
 	copy(d.buf[offset:], v.buf)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddArray ...
 func (d *Doc) AddArray(k string, v *Array) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -301,13 +329,13 @@ func (d *Doc) AddArray(k string, v *Array) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeArray, k)
 	copy(d.buf[offset:], v.d.buf)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddBinary ...
-func (d *Doc) AddBinary(k string, v *primitive.Binary) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddBinary(k string, v *Binary) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -327,13 +355,13 @@ func (d *Doc) AddBinary(k string, v *primitive.Binary) *Doc {
 	}
 	copy(d.buf[offset:], v.Data)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddUndefined ...
 func (d *Doc) AddUndefined(k string) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -341,13 +369,13 @@ func (d *Doc) AddUndefined(k string) *Doc {
 	d.grow(2 + len(k))
 	offset = writeTypeAndKey(d.buf, offset, TypeUndefined, k)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddOID ...
-func (d *Doc) AddOID(k string, v primitive.ObjectID) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddOID(k string, v ObjectID) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -356,13 +384,29 @@ func (d *Doc) AddOID(k string, v primitive.ObjectID) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeObjectID, k)
 	copy(d.buf[offset:], v[:])
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
+}
+
+// AddNewOID adds a newly generated ObjectID, writing it directly into the
+// document buffer.
+func (d *Doc) AddNewOID(k string) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
+		return d
+	}
+	offset := len(d.buf) - 1
+	// Add space for type byte + len(key) + null byte + OID length (12)
+	d.grow(len(k) + 14)
+	offset = writeTypeAndKey(d.buf, offset, TypeObjectID, k)
+	putNewObjectID(d.buf[offset:], time.Now())
+	d.buf[len(d.buf)-1] = 0
+	return d.endAdd(k, start)
 }
 
 // AddBool ...
 func (d *Doc) AddBool(k string, v bool) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -375,13 +419,13 @@ func (d *Doc) AddBool(k string, v bool) *Doc {
 		d.buf[offset] = 0
 	}
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddDateTime ...
-func (d *Doc) AddDateTime(k string, v primitive.DateTime) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddDateTime(k string, v DateTime) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -390,18 +434,18 @@ func (d *Doc) AddDateTime(k string, v primitive.DateTime) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeDateTime, k)
 	writeInt64(d.buf, offset, int64(v))
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddDateTimeFromTime ...
 func (d *Doc) AddDateTimeFromTime(k string, v time.Time) *Doc {
-	return d.AddDateTime(k, primitive.NewDateTimeFromTime(v))
+	return d.AddDateTime(k, NewDateTimeFromTime(v))
 }
 
 // AddNull ...
 func (d *Doc) AddNull(k string) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -409,13 +453,13 @@ func (d *Doc) AddNull(k string) *Doc {
 	d.grow(2 + len(k))
 	offset = writeTypeAndKey(d.buf, offset, TypeNull, k)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddRegex ...
-func (d *Doc) AddRegex(k string, v primitive.Regex) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddRegex(k string, v Regex) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -426,13 +470,13 @@ func (d *Doc) AddRegex(k string, v primitive.Regex) *Doc {
 	offset = writeCString(d.buf, offset, v.Pattern)
 	writeCString(d.buf, offset, v.Options)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddDBPointer ...
-func (d *Doc) AddDBPointer(k string, v primitive.DBPointer) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddDBPointer(k string, v DBPointer) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -443,13 +487,13 @@ func (d *Doc) AddDBPointer(k string, v primitive.DBPointer) *Doc {
 	offset = writeString(d.buf, offset, v.DB)
 	copy(d.buf[offset:], v.Pointer[:])
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddJavaScript ...
-func (d *Doc) AddJavaScript(k string, v primitive.JavaScript) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddJavaScript(k string, v JavaScript) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -458,13 +502,13 @@ func (d *Doc) AddJavaScript(k string, v primitive.JavaScript) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeJavaScript, k)
 	writeString(d.buf, offset, string(v))
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddSymbol ...
-func (d *Doc) AddSymbol(k string, v primitive.Symbol) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddSymbol(k string, v Symbol) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -473,13 +517,13 @@ func (d *Doc) AddSymbol(k string, v primitive.Symbol) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeSymbol, k)
 	writeString(d.buf, offset, string(v))
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddCodeScope ...
 func (d *Doc) AddCodeScope(k string, v CodeWithScope) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -500,16 +544,16 @@ func (d *Doc) AddCodeScope(k string, v CodeWithScope) *Doc {
 	if v.Scope != nil {
 		copy(d.buf[offset:], v.Scope.buf)
 	} else {
-		d.buf[offset] = 5
+		copy(d.buf[offset:], emptyDoc)
 	}
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddInt32 ...
 func (d *Doc) AddInt32(k string, v int32) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -518,13 +562,13 @@ func (d *Doc) AddInt32(k string, v int32) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeInt32, k)
 	writeInt32(d.buf, offset, v)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddTimestamp ...
-func (d *Doc) AddTimestamp(k string, v primitive.Timestamp) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddTimestamp(k string, v Timestamp) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -534,13 +578,13 @@ func (d *Doc) AddTimestamp(k string, v primitive.Timestamp) *Doc {
 	offset = writeUint32(d.buf, offset, v.I)
 	writeUint32(d.buf, offset, v.T)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddInt64 ...
 func (d *Doc) AddInt64(k string, v int64) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -549,13 +593,13 @@ func (d *Doc) AddInt64(k string, v int64) *Doc {
 	offset = writeTypeAndKey(d.buf, offset, TypeInt64, k)
 	writeInt64(d.buf, offset, v)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddDecimal128 ...
-func (d *Doc) AddDecimal128(k string, v primitive.Decimal128) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+func (d *Doc) AddDecimal128(k string, v Decimal128) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	h, l := v.GetBytes()
@@ -566,13 +610,13 @@ func (d *Doc) AddDecimal128(k string, v primitive.Decimal128) *Doc {
 	offset = writeUint64(d.buf, offset, l)
 	writeUint64(d.buf, offset, h)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddMaxKey ...
 func (d *Doc) AddMaxKey(k string) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -580,13 +624,13 @@ func (d *Doc) AddMaxKey(k string) *Doc {
 	d.grow(2 + len(k))
 	offset = writeTypeAndKey(d.buf, offset, TypeMaxKey, k)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
 }
 
 // AddMinKey ...
 func (d *Doc) AddMinKey(k string) *Doc {
-	if d.immutable || !d.valid {
-		d.err = errImmutableInvalid
+	start, ok := d.beginAdd(k)
+	if !ok {
 		return d
 	}
 	offset := len(d.buf) - 1
@@ -594,5 +638,30 @@ func (d *Doc) AddMinKey(k string) *Doc {
 	d.grow(2 + len(k))
 	offset = writeTypeAndKey(d.buf, offset, TypeMinKey, k)
 	d.buf[len(d.buf)-1] = 0
-	return d
+	return d.endAdd(k, start)
+}
+
+// AddValue appends a copy of the bytes of v, such as a view from
+// DocIter.ValueUnsafe, without decoding it.  If v has an error or is
+// invalid, the error is recorded on the document instead.
+func (d *Doc) AddValue(k string, v Value) *Doc {
+	start, ok := d.beginAdd(k)
+	if !ok {
+		return d
+	}
+	if err := v.Err(); err != nil {
+		d.err = err
+		return d
+	}
+	if v.Type() == TypeInvalid {
+		d.err = ErrInvalidValue
+		return d
+	}
+	offset := len(d.buf) - 1
+	// Add space for type byte + len(key) + null byte + value bytes
+	d.grow(2 + len(k) + v.Len())
+	offset = writeTypeAndKey(d.buf, offset, v.Type(), k)
+	v.CopyTo(d.buf[offset:])
+	d.buf[len(d.buf)-1] = 0
+	return d.endAdd(k, start)
 }
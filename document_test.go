@@ -1,11 +1,9 @@
 package bsony
 
 import (
+	"encoding/hex"
 	"testing"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestRelease(t *testing.T) {
@@ -24,7 +22,7 @@ func TestRelease(t *testing.T) {
 	if doc.factory != nil {
 		t.Error("released doc factory non-nil")
 	}
-	assertErr(t, doc.Err(), errBufferReleased)
+	assertErr(t, doc.Err(), ErrBufferReleased)
 }
 
 func TestClone(t *testing.T) {
@@ -50,15 +48,14 @@ const (
 func TestAdd(t *testing.T) {
 	fct := New()
 	testArray := fct.NewArray()
-	testBinary := primitive.Binary{Subtype: 1, Data: []byte{255, 255}}
+	testBinary := Binary{Subtype: 1, Data: []byte{255, 255}}
 	testDoc := fct.NewDoc()
-	testOID, _ := primitive.ObjectIDFromHex("56e1fc72e0c917e9c4714161")
-	testRegex := primitive.Regex{Pattern: "abc", Options: "im"}
+	testOID, _ := ObjectIDFromHex("56e1fc72e0c917e9c4714161")
+	testRegex := Regex{Pattern: "abc", Options: "im"}
 	testTime, _ := time.Parse(rfc3339Milli, "2012-12-24T12:15:30.501Z")
-	testDBPointer := primitive.DBPointer{DB: "b", Pointer: testOID}
+	testDBPointer := DBPointer{DB: "b", Pointer: testOID}
 	testCodeScope := CodeWithScope{Code: "abcd", Scope: fct.NewDoc()}
-	testPrimitiveCodeScope := primitive.CodeWithScope{Code: "abcd", Scope: &bson.D{}}
-	testDecimal128, _ := primitive.ParseDecimal128("0")
+	testDecimal128, _ := ParseDecimal128("0")
 
 	addCases := []AddTestCase{
 		{"float64", "d", float64(1.0), "10000000016400000000000000F03F00"},
@@ -70,29 +67,28 @@ func TestAdd(t *testing.T) {
 		{"array (value)", "x", *testArray, "0D000000047800050000000000"},
 		{"binary (pointer)", "x", &testBinary, "0F0000000578000200000001FFFF00"},
 		{"binary (value)", "x", testBinary, "0F0000000578000200000001FFFF00"},
-		{"undefined", "a", primitive.Undefined{}, "0800000006610000"},
+		{"undefined", "a", Undefined{}, "0800000006610000"},
 		{"oid", "a", testOID, "1400000007610056E1FC72E0C917E9C471416100"},
 		{"boolean", "b", true, "090000000862000100"},
 		{"datetime (pointer)", "a", &testTime, "10000000096100C5D8D6CC3B01000000"},
 		{"datetime (value)", "a", testTime, "10000000096100C5D8D6CC3B01000000"},
-		{"datetime (primitive)", "a", primitive.NewDateTimeFromTime(testTime), "10000000096100C5D8D6CC3B01000000"},
+		{"datetime (DateTime)", "a", NewDateTimeFromTime(testTime), "10000000096100C5D8D6CC3B01000000"},
 		{"null", "a", nil, "080000000a610000"},
 		{"regex (pointer)", "a", &testRegex, "0F0000000B610061626300696D0000"},
 		{"regex (value)", "a", testRegex, "0F0000000B610061626300696D0000"},
 		{"DBPointer (pointer)", "a", &testDBPointer, "1A0000000C610002000000620056E1FC72E0C917E9C471416100"},
 		{"DBPointer (value)", "a", testDBPointer, "1A0000000C610002000000620056E1FC72E0C917E9C471416100"},
-		{"JavaScript", "a", primitive.JavaScript("b"), "0E0000000D610002000000620000"},
-		{"Symbol", "a", primitive.Symbol("b"), "0E0000000E610002000000620000"},
+		{"JavaScript", "a", JavaScript("b"), "0E0000000D610002000000620000"},
+		{"Symbol", "a", Symbol("b"), "0E0000000E610002000000620000"},
 		{"Code with Scope (bsony)", "a", testCodeScope, "1A0000000F610012000000050000006162636400050000000000"},
-		{"Code with Scope (primitive)", "a", testPrimitiveCodeScope, "1A0000000F610012000000050000006162636400050000000000"},
 		{"CodeWithScope (nil scope)", "a", CodeWithScope{Code: "abcd"}, "1A0000000F610012000000050000006162636400050000000000"},
 		{"int32", "i", int32(-1), "0C000000106900FFFFFFFF00"},
-		{"timestamp", "a", primitive.Timestamp{T: 123456789, I: 42}, "100000001161002A00000015CD5B0700"},
+		{"timestamp", "a", Timestamp{T: 123456789, I: 42}, "100000001161002A00000015CD5B0700"},
 		{"int64", "a", int64(1), "10000000126100010000000000000000"},
 		{"decimal128 (pointer)", "d", &testDecimal128, "180000001364000000000000000000000000000000403000"},
 		{"decimal128 (value)", "d", testDecimal128, "180000001364000000000000000000000000000000403000"},
-		{"minkey", "a", primitive.MinKey{}, "08000000FF610000"},
-		{"maxkey", "a", primitive.MaxKey{}, "080000007F610000"},
+		{"minkey", "a", MinKey{}, "08000000FF610000"},
+		{"maxkey", "a", MaxKey{}, "080000007F610000"},
 	}
 
 	t.Run("Doc.Add", func(t *testing.T) {
@@ -104,6 +100,36 @@ func TestAdd(t *testing.T) {
 		}
 	})
 
+	t.Run("Doc.Add (dirty pool)", func(t *testing.T) {
+		dirtyFct := NewFromPool(dirtyPool{})
+		compareDocHex(t, dirtyFct.NewDoc(), "0500000000", "empty doc")
+		compareDocHex(t, dirtyFct.NewDocWithCapacity(100), "0500000000", "empty doc with capacity")
+		for _, c := range addCases {
+			d := dirtyFct.NewDoc()
+			d.Add(c.K, c.V)
+			compareDocHex(t, d, c.D, c.L)
+			sized := dirtyFct.NewDocWithCapacity(100)
+			sized.Add(c.K, c.V)
+			compareDocHex(t, sized, c.D, c.L)
+		}
+		// A nil scope is written as an empty document over the garbage.
+		d := dirtyFct.NewDoc().AddCodeScope("a", CodeWithScope{Code: "abcd"})
+		compareDocHex(t, d, "1A0000000F610012000000050000006162636400050000000000", "AddCodeScope (nil scope)")
+	})
+
 	// Delegate array testing with same data
-	testArrayAdd(t, addCases)
+	testArrayAdd(t, fct, "", addCases)
+	testArrayAdd(t, NewFromPool(dirtyPool{}), "dirty pool", addCases)
+}
+
+func TestBytesUnsafe(t *testing.T) {
+	fct := New()
+	d := fct.NewDoc().AddInt32("a", 1)
+	if got := hex.EncodeToString(d.BytesUnsafe()); got != "0c0000001061000100000000" {
+		t.Errorf("BytesUnsafe incorrect: got %s", got)
+	}
+	d.Release()
+	if d.BytesUnsafe() != nil {
+		t.Error("BytesUnsafe of released doc should be nil")
+	}
 }
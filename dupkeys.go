@@ -0,0 +1,226 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrDuplicateKey is recorded on a document when an element is added with
+// a key it already has, or returned when a document with duplicate keys is
+// decoded, if the factory's policy is DuplicateKeysError.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// A DuplicateKeyPolicy says what a factory does with duplicate keys.
+type DuplicateKeyPolicy int
+
+// Duplicate key policies
+const (
+	// DuplicateKeysAllow adds and decodes duplicate keys as BSON allows.
+	DuplicateKeysAllow DuplicateKeyPolicy = iota
+	// DuplicateKeysError records ErrDuplicateKey on a document instead of
+	// adding an element with a key it already has, and rejects decoded
+	// documents with duplicate keys at any depth.
+	DuplicateKeysError
+	// DuplicateKeysReplace replaces the value of an element with the key
+	// being added, keeping its position.  Decoded documents are not checked.
+	DuplicateKeysReplace
+)
+
+// dupKeyThreshold is the number of elements above which duplicate keys are
+// found with a hash set rather than a linear scan.
+const dupKeyThreshold = 16
+
+// WithDuplicateKeys sets the policy for duplicate keys in documents from the
+// factory and returns the factory.  It applies to the Add methods, to
+// Concat, Clone and Transform, and to NewDocFromBytes and NewDocFromReader.
+// It must be called before the factory is used.  The default is
+// DuplicateKeysAllow.
+func (f *Factory) WithDuplicateKeys(p DuplicateKeyPolicy) *Factory {
+	f.dupKeys = p
+	return f
+}
+
+// HasDuplicateKeys reports whether any key appears more than once among the
+// elements of d.  Embedded documents aren't checked.  Elements after one
+// that can't be parsed aren't checked.
+func (d *Doc) HasDuplicateKeys() bool {
+	return d.valid && d.duplicateKey() != nil
+}
+
+// duplicateKey returns an iterator at the first element of d with a key
+// that an earlier element has, or nil if there is none.
+func (d *Doc) duplicateKey() *DocIter {
+	var keys [][]byte
+	var seen map[string]bool
+	iter := d.Iter()
+	for iter.Next() {
+		k := iter.keyBytes()
+		if seen != nil {
+			if seen[string(k)] {
+				return iter
+			}
+			seen[string(k)] = true
+			continue
+		}
+		for _, x := range keys {
+			if string(x) == string(k) {
+				return iter
+			}
+		}
+		keys = append(keys, k)
+		if len(keys) > dupKeyThreshold {
+			seen = make(map[string]bool, 2*len(keys))
+			for _, x := range keys {
+				seen[string(x)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// checkDuplicateKeys returns a DecodeError wrapping ErrDuplicateKey for the
+// first duplicate key in d or its embedded documents and code with scope
+// scopes.  Array keys aren't checked.  Values that can't be parsed end the
+// check but aren't reported, as they are reported when the document is read.
+func checkDuplicateKeys(d *Doc) error {
+	return checkDuplicateKeysAt(d, 0, false, nil)
+}
+
+// checkDuplicateKeysAt checks d, a document or array starting at offset base
+// in the top-level document, whose elements have the keys in path.
+func checkDuplicateKeysAt(d *Doc, base int, isArray bool, path []string) error {
+	if !isArray {
+		if iter := d.duplicateKey(); iter != nil {
+			k := iter.Key()
+			return elementError(base, iter, append(path, k), fmt.Errorf("%w %q", ErrDuplicateKey, k))
+		}
+	}
+	iter := d.Iter()
+	for iter.Next() {
+		sub, err := subDoc(iter.vu)
+		if err != nil {
+			return nil
+		}
+		if sub == nil {
+			continue
+		}
+		subPath := append(path[:len(path):len(path)], iter.Key())
+		if err := d.factory.limits.checkDepth(len(subPath) + 1); err != nil {
+			return elementError(base, iter, subPath, err)
+		}
+		err = checkDuplicateKeysAt(sub, subOffset(base, iter, sub), iter.Type() == TypeArray, subPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// beginAdd checks that an element with key k can be added to d, given its
+// key rules and duplicate key policy, and returns the offset to write it at.
+// If it can't be added, the error is recorded on d.  Nothing more is added
+// once d has an error.
+func (d *Doc) beginAdd(k string) (int, bool) {
+	if d.immutable || !d.valid {
+		d.err = ErrImmutable
+		return 0, false
+	}
+	if d.err != nil {
+		return 0, false
+	}
+	if err := d.checkAddKey(k); err != nil {
+		d.err = err
+		return 0, false
+	}
+	if d.factory.dupKeys == DuplicateKeysError && d.findKey(k, len(d.buf)-1) != nil {
+		d.err = fmt.Errorf("%w %q", ErrDuplicateKey, k)
+		return 0, false
+	}
+	return len(d.buf) - 1, true
+}
+
+// endAdd finishes adding the element with key k written at start, dropping
+// the key index and replacing an earlier element with the same key under
+// DuplicateKeysReplace, and returns d.  An element breaking the storage
+// rules of the factory is removed again and the error recorded on d.
+func (d *Doc) endAdd(k string, start int) *Doc {
+	d.dropIndex()
+	if err := d.checkAddedValue(start); err != nil {
+		d.truncate(start)
+		d.err = err
+		return d
+	}
+	switch d.factory.dupKeys {
+	case DuplicateKeysError:
+		d.noteKey(k)
+	case DuplicateKeysReplace:
+		if iter := d.findKey(k, start); iter != nil {
+			d.replaceElement(iter.offset, iter.keyLen+len(iter.vu.data)+2, start)
+		} else {
+			d.noteKey(k)
+		}
+	}
+	return d
+}
+
+// findKey returns an iterator at the first element of d before offset end
+// with key k, or nil if there is none.  Documents with more than
+// dupKeyThreshold elements keep a set of their keys so that most keys
+// aren't found without a scan.
+func (d *Doc) findKey(k string, end int) *DocIter {
+	if d.keys != nil && !d.keys[k] {
+		return nil
+	}
+	n := 0
+	iter := d.Iter()
+	for iter.Next() && iter.offset < end {
+		if string(iter.keyBytes()) == k {
+			return iter
+		}
+		n++
+	}
+	if d.keys == nil && n > dupKeyThreshold {
+		d.keys = make(map[string]bool, 2*n)
+		iter = d.Iter()
+		for iter.Next() && iter.offset < end {
+			d.keys[iter.Key()] = true
+		}
+	}
+	return nil
+}
+
+// noteKey adds k to the key set of d, if it has one.
+func (d *Doc) noteKey(k string) {
+	if d.keys != nil {
+		d.keys[k] = true
+	}
+}
+
+// replaceElement moves the element from start to the end of d in place of
+// the element of length n at old.
+func (d *Doc) replaceElement(old, n, start int) {
+	// Rotate the new element to the front of the elements from old, then
+	// close the gap left by the old element.
+	s := d.buf[old : len(d.buf)-1]
+	m := len(d.buf) - 1 - start
+	reverseBytes(s)
+	reverseBytes(s[:m])
+	reverseBytes(s[m:])
+	copy(s[m:], s[m+n:])
+	d.buf = d.buf[:len(d.buf)-n]
+	d.buf[len(d.buf)-1] = 0
+	binary.LittleEndian.PutUint32(d.buf[0:4], uint32(len(d.buf)))
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// wideDoc returns a document with int32 elements "k0" to "k<n-1>".
+func wideDoc(f *Factory, n int) *Doc {
+	d := f.NewDoc()
+	for i := 0; i < n; i++ {
+		d.AddInt32("k"+strconv.Itoa(i), int32(i))
+	}
+	return d
+}
+
+func TestHasDuplicateKeys(t *testing.T) {
+	fct := New()
+	for _, n := range []int{2, dupKeyThreshold, 4 * dupKeyThreshold} {
+		d := wideDoc(fct, n)
+		if d.HasDuplicateKeys() {
+			t.Errorf("%d keys: unexpected duplicate", n)
+		}
+		d.AddString("k1", "again")
+		if !d.HasDuplicateKeys() {
+			t.Errorf("%d keys: duplicate not found", n)
+		}
+		d.Release()
+	}
+	if New().NewDoc().HasDuplicateKeys() {
+		t.Error("empty document has duplicates")
+	}
+}
+
+func TestDuplicateKeysError(t *testing.T) {
+	fct := New().WithDuplicateKeys(DuplicateKeysError)
+	for _, n := range []int{2, 4 * dupKeyThreshold} {
+		d := wideDoc(fct, n)
+		want := d.Clone()
+		d.AddString("k1", "again")
+		assertErrIs(t, d.Err(), ErrDuplicateKey)
+		compareDocs(t, d, want, "duplicate not added")
+		if d.HasDuplicateKeys() {
+			t.Errorf("%d keys: unexpected duplicate", n)
+		}
+		// The error is sticky, so nothing more is added.
+		d.AddInt32("new", 1)
+		assertErrIs(t, d.Err(), ErrDuplicateKey)
+		compareDocs(t, d, want, "nothing added after error")
+		want.Release()
+		d.Release()
+	}
+
+	// Concat applies the policy to each element.
+	d := fct.NewDoc().AddInt32("a", 1)
+	d.Concat(New().NewDoc().AddInt32("b", 2).AddInt32("a", 3))
+	assertErrIs(t, d.Err(), ErrDuplicateKey)
+	compareDocs(t, d, New().NewDoc().AddInt32("a", 1).AddInt32("b", 2), "concat")
+	d.Release()
+
+	// Arrays are unaffected.
+	a := fct.NewArray(int32(1), int32(2), int32(3))
+	if a.Err() != nil {
+		t.Errorf("unexpected array error: %v", a.Err())
+	}
+	a.Release()
+}
+
+func TestDuplicateKeysReplace(t *testing.T) {
+	fct := New().WithDuplicateKeys(DuplicateKeysReplace)
+	d := fct.NewDoc().AddInt32("a", 1).AddString("b", "x").AddInt32("c", 3)
+	d.AddString("a", "longer value").AddNull("c").AddInt32("b", 2)
+	want := New().NewDoc().AddString("a", "longer value").AddInt32("b", 2).AddNull("c")
+	compareDocs(t, d, want, "replaced in place")
+	if d.Err() != nil {
+		t.Errorf("unexpected error: %v", d.Err())
+	}
+	d.Release()
+	want.Release()
+
+	n := 4 * dupKeyThreshold
+	d = wideDoc(fct, n)
+	d.AddString("k5", "five").AddInt32("extra", 1)
+	want = New().NewDoc()
+	for i := 0; i < n; i++ {
+		if i == 5 {
+			want.AddString("k5", "five")
+			continue
+		}
+		want.AddInt32("k"+strconv.Itoa(i), int32(i))
+	}
+	want.AddInt32("extra", 1)
+	compareDocs(t, d, want, "wide document")
+	d.Release()
+	want.Release()
+}
+
+func TestDuplicateKeysDecode(t *testing.T) {
+	inner := New().NewDoc().AddInt32("a", 1).AddInt32("a", 2)
+	src := New().NewDoc().AddInt32("a", 1).AddDoc("x", inner)
+	buf := make([]byte, src.Len())
+	src.CopyTo(buf)
+
+	d, err := New().NewDocFromBytes(append([]byte{}, buf...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Release()
+
+	_, err = New().WithDuplicateKeys(DuplicateKeysError).NewDocFromBytes(buf)
+	assertErrIs(t, err, ErrDuplicateKey)
+	var de *DecodeError
+	// "x" is at 11; its second element is at 11 + 3 + 4 + 7.
+	if !errors.As(err, &de) || de.Path != "x.a" || de.Offset != 25 || de.Type != TypeInt32 {
+		t.Errorf("expected int32 error at x.a, offset 25, got %v", err)
+	}
+	inner.Release()
+	src.Release()
+}
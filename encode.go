@@ -3,13 +3,13 @@ package bsony
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"math"
 )
 
 func hasEnoughBytes(b []byte, offset int, n int) error {
 	if len(b)-offset < n {
-		return errShortDoc
+		return ErrShortDoc
 	}
 	return nil
 }
@@ -25,12 +25,12 @@ func writeTypeAndKey(dst []byte, offset int, t Type, key string) int {
 
 func readTypeAndKey(src []byte, offset int) (Type, string, error) {
 	if err := hasEnoughBytes(src, offset, 2); err != nil {
-		return 0, "", err
+		return 0, "", &DecodeError{Offset: offset, Err: err}
 	}
 	t := src[offset]
 	nullByteOffset := bytes.IndexByte(src[offset+1:], 0)
 	if nullByteOffset == -1 {
-		return 0, "", errors.New("key not found")
+		return 0, "", &DecodeError{Offset: offset, Type: Type(t), Err: fmt.Errorf("key %w", ErrMissingTerminator)}
 	}
 	key := string(src[offset+1 : offset+1+nullByteOffset])
 	return Type(t), key, nil
@@ -109,7 +109,7 @@ func readCString(src []byte, offset int) (string, error) {
 	}
 	nullPos := bytes.IndexByte(src[offset:], 0)
 	if nullPos == -1 {
-		return "", errors.New("cstring null terminator not found")
+		return "", fmt.Errorf("cstring %w", ErrMissingTerminator)
 	}
 	return string(src[offset : offset+nullPos]), nil
 }
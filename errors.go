@@ -0,0 +1,100 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors for corrupt BSON.  Decoding errors wrap one of these in a
+// DecodeError, so they can be tested with errors.Is.
+var (
+	// ErrShortDoc means a length or value runs past the end of the bytes
+	// available.
+	ErrShortDoc = errors.New("not enough bytes available to read value")
+	// ErrInvalidLength means a length is negative, too small or inconsistent
+	// with the bytes around it.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrMissingTerminator means a document, string or key is missing its
+	// null terminator.
+	ErrMissingTerminator = errors.New("missing null terminator")
+	// ErrInvalidValue means a value's bytes aren't valid for its type.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrUnknownType means an element has a type byte that isn't a BSON
+	// type.
+	ErrUnknownType = errors.New("unknown BSON type")
+)
+
+// Errors for misuse of documents and values.
+var (
+	// ErrImmutable is recorded on a document, e.g. a view or a frozen
+	// document, that is modified.
+	ErrImmutable = errors.New("can't modify immutable or invalid document")
+	// ErrBufferReleased is recorded on a document or value when it is
+	// released.
+	ErrBufferReleased = errors.New("buffer released")
+	// ErrWrongType is returned when a value is viewed as a different type.
+	ErrWrongType = errors.New("wrong type for view")
+)
+
+// A DecodeError describes corrupt BSON and where it was found.
+type DecodeError struct {
+	// Offset is the offset in the document of the element with the
+	// error, i.e. of its type byte.  For an error in the framing of the
+	// document itself, it is the offset of the bad length or terminator.
+	// Offsets are relative to the document being iterated, or to the
+	// top-level document for Walk and Transform.
+	Offset int
+	// Path is the key of the element, or the dotted path to it for Walk and
+	// Transform.  It is empty for an error in the framing of the document.
+	Path string
+	// Type is the type of the element, if known.
+	Type Type
+	// Err is the underlying error, which wraps one of the sentinel errors.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	what := "document"
+	if e.Type != TypeInvalid {
+		what = e.Type.String()
+	}
+	if e.Path != "" {
+		what += fmt.Sprintf(" %q", e.Path)
+	}
+	return fmt.Sprintf("%s at offset %d: %v", what, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// errorf returns an error wrapping the sentinel err with a formatted
+// explanation.
+func errorf(err error, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{err}, args...)...)
+}
+
+// elementError returns err as a DecodeError for the current element of iter,
+// with the dotted path to the element and its offset in the top-level
+// document, in which the iterated document starts at offset base.  The type
+// and underlying error of a DecodeError from the iterator are kept.
+func elementError(base int, iter *DocIter, path []string, err error) error {
+	e := &DecodeError{
+		Offset: base + iter.offset,
+		Path:   strings.Join(path, "."),
+		Type:   iter.Type(),
+		Err:    err,
+	}
+	if de, ok := err.(*DecodeError); ok {
+		e.Type, e.Err = de.Type, de.Err
+	}
+	return e
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDecodeError(t *testing.T) {
+	cases := []struct {
+		label  string
+		src    string
+		err    error
+		offset int
+		path   string
+		typ    Type
+	}{
+		{"short", "0500", ErrShortDoc, 0, "", TypeInvalid},
+		{"bad length", "050000000000", ErrInvalidLength, 0, "", TypeInvalid},
+		{"unterminated", "0500000001", ErrMissingTerminator, 4, "", TypeInvalid},
+		{"bad boolean", "10000000106100010000000862000200", ErrInvalidValue, 11, "b", TypeBoolean},
+		{"unknown type", "0800000042610000", ErrUnknownType, 4, "a", Type(0x42)},
+		{"exceeds container", "0e00000002610003000000610000", ErrInvalidLength, 4, "a", TypeString},
+	}
+
+	fct := New()
+	for _, c := range cases {
+		buf, err := hex.DecodeString(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := fct.NewDocFromBytes(buf)
+		if err == nil {
+			// Framing is valid, so the error is found by iterating.
+			iter := doc.Iter()
+			for iter.Next() {
+			}
+			err = iter.Err()
+			doc.Release()
+		}
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: expected '%v', got '%v'", c.label, c.err, err)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: expected DecodeError, got %T", c.label, err)
+			continue
+		}
+		if de.Offset != c.offset || de.Path != c.path || de.Type != c.typ {
+			t.Errorf("%s: expected offset %d, path %q, type %v, got %d, %q, %v",
+				c.label, c.offset, c.path, c.typ, de.Offset, de.Path, de.Type)
+		}
+	}
+}
+
+func TestDecodeErrorString(t *testing.T) {
+	err := &DecodeError{Offset: 11, Path: "b", Type: TypeBoolean, Err: errorf(ErrInvalidValue, "boolean data byte %d", 2)}
+	want := `boolean "b" at offset 11: invalid value: boolean data byte 2`
+	if err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+	err = &DecodeError{Offset: 4, Err: ErrMissingTerminator}
+	want = "document at offset 4: missing null terminator"
+	if err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestReadTypeAndKeyError(t *testing.T) {
+	_, _, err := readTypeAndKey([]byte{0x10, 'a', 'b'}, 0)
+	assertErrIs(t, err, ErrMissingTerminator)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Offset != 0 || de.Type != TypeInt32 {
+		t.Errorf("expected int32 DecodeError at offset 0, got %v", err)
+	}
+	_, _, err = readTypeAndKey([]byte{0x10}, 0)
+	assertErrIs(t, err, ErrShortDoc)
+}
+
+func TestElementErrorOffset(t *testing.T) {
+	fct := New()
+	cws := func(scope *Doc) *Doc {
+		return fct.NewDoc().AddArray("a", fct.NewArray(CodeWithScope{Code: "f", Scope: scope}))
+	}
+	// The scope of a.0 starts at 24, so its first element is at 28.
+	d := cws(fct.NewDoc().AddString("x", "xy"))
+	d.buf[31] = 0x7f
+	err := Walk(d, func([]string, Value) WalkAction { return WalkContinue })
+	assertOffset(t, "Walk", err, "a.0.x", 28)
+	_, err = Transform(d, func([]string, Value) Change { return Change{} })
+	assertOffset(t, "Transform", err, "a.0.x", 28)
+	d.Release()
+
+	d = cws(fct.NewDoc().AddInt32("y", 1).AddInt32("y", 2))
+	assertOffset(t, "duplicate keys", checkDuplicateKeys(d), "a.0.y", 35)
+	d.Release()
+
+	// a.0.b starts at 21.
+	d = fct.NewDoc().AddArray("a", fct.NewArray(fct.NewDoc().AddDoc("b", fct.NewDoc().AddInt32("$x", 1))))
+	assertOffset(t, "ValidateStorage", d.ValidateStorage(), "a.0.b.$x", 25)
+	d.Release()
+}
+
+func assertOffset(t *testing.T, label string, err error, path string, offset int) {
+	t.Helper()
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Path != path || de.Offset != offset {
+		t.Errorf("%s: expected error at %s, offset %d, got %v", label, path, offset, err)
+	}
+}
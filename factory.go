@@ -7,10 +7,20 @@
 // package bsony ...
 package bsony
 
+import (
+	"encoding/binary"
+	"io"
+)
+
 // A Factory object is a factory for generating BSON documents and arrays.  If Pool
 // is nil, byte slices will be created as needed and not recycled.
 type Factory struct {
-	pool ByteSlicePool
+	pool    ByteSlicePool
+	tracker *tracker      // non-nil for an Arena
+	dbg     *debugOptions // non-nil in debug mode
+	limits  limits
+	dupKeys DuplicateKeyPolicy
+	storage bool // enforce storage rules; see WithStorageRules
 
 	// XXX should we have pools for D, A, Value, etc.?
 }
@@ -29,9 +39,22 @@ func NewFromPool(pool ByteSlicePool) *Factory {
 
 // NewDoc returns a new, empty BSON document
 func (f *Factory) NewDoc() *Doc {
-	buf := f.pool.Get()
-	d := &Doc{factory: f, buf: buf, valid: true}
+	d := f.newDoc(f.pool.Get())
+	d.grow(5)
+	d.buf[4] = 0
+	return d
+}
+
+// NewDocWithCapacity returns a new, empty BSON document with room for n
+// bytes of encoded document, so adding elements up to that size doesn't
+// resize the buffer.
+func (f *Factory) NewDocWithCapacity(n int) *Doc {
+	if n < 5 {
+		n = 5
+	}
+	d := f.newDoc(f.get(n)[0:0])
 	d.grow(5)
+	d.buf[4] = 0
 	return d
 }
 
@@ -39,10 +62,108 @@ func (f *Factory) NewDoc() *Doc {
 // takes ownership of buf and the caller should not use it after calling
 // NewDocFromBytes.
 func (f *Factory) NewDocFromBytes(buf []byte) (*Doc, error) {
+	if err := f.limits.checkSize(len(buf)); err != nil {
+		return nil, err
+	}
 	if err := validateBSONFraming(buf); err != nil {
 		return nil, err
 	}
-	return &Doc{factory: f, buf: buf, valid: true}, nil
+	if err := f.check(f.view(buf)); err != nil {
+		return nil, err
+	}
+	return f.newDoc(buf), nil
+}
+
+// NewArrayFromBytes returns a BSON array based on a slice of bytes.  The
+// array takes ownership of buf and the caller should not use it after calling
+// NewArrayFromBytes.  Keys are assumed to be the consecutive indices required
+// by the BSON specification.
+func (f *Factory) NewArrayFromBytes(buf []byte) (*Array, error) {
+	d, err := f.NewDocFromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	iter := d.Iter()
+	for iter.Next() {
+		if err := iter.Err(); err != nil {
+			d.Release()
+			return nil, err
+		}
+		n++
+	}
+	return &Array{d: d, n: n}, nil
+}
+
+// NewDocFromReader reads a single BSON document from r.  It returns io.EOF if
+// r has no more bytes before the start of a document and
+// io.ErrUnexpectedEOF if a document is truncated.  Reading stops at the end
+// of the document, so concatenated documents can be read by calling
+// NewDocFromReader repeatedly.
+func (f *Factory) NewDocFromReader(r io.Reader) (*Doc, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(int32(binary.LittleEndian.Uint32(header[:])))
+	if length < 5 {
+		return nil, &DecodeError{Err: errorf(ErrInvalidLength, "document length %d is too small", length)}
+	}
+	if err := f.limits.checkSize(length); err != nil {
+		return nil, err
+	}
+	buf := f.get(length)
+	copy(buf, header[:])
+	if _, err := io.ReadFull(r, buf[4:]); err != nil {
+		f.release(buf)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if buf[length-1] != 0 {
+		f.release(buf)
+		return nil, &DecodeError{Offset: length - 1, Err: ErrMissingTerminator}
+	}
+	if err := f.check(f.view(buf)); err != nil {
+		f.release(buf)
+		return nil, err
+	}
+	return f.newDoc(buf), nil
+}
+
+// check returns an error if a decoded document exceeds the limits of the
+// factory or breaks its duplicate key policy or storage rules.
+func (f *Factory) check(d *Doc) error {
+	if err := f.limits.checkLimits(d); err != nil {
+		return err
+	}
+	if f.dupKeys == DuplicateKeysError {
+		if err := checkDuplicateKeys(d); err != nil {
+			return err
+		}
+	}
+	if f.storage {
+		return d.ValidateStorage()
+	}
+	return nil
+}
+
+// newDoc returns a document owning buf, tracked by the factory's arena and
+// debug checks, if any.
+func (f *Factory) newDoc(buf []byte) *Doc {
+	d := &Doc{factory: f, buf: buf, valid: true}
+	if f.dbg != nil {
+		f.dbg.watch(d)
+	}
+	f.track(d)
+	return d
+}
+
+// view returns an immutable document sharing buf, which must be framed
+// correctly.
+func (f *Factory) view(buf []byte) *Doc {
+	return &Doc{factory: f, buf: buf, valid: true, immutable: true}
 }
 
 // NewArray returns a BSON array.  Any arguments will be added to the array.
@@ -52,8 +173,28 @@ func (f *Factory) NewArray(xs ...interface{}) *Array {
 	return ary
 }
 
-// release returns a byte slice to a pool
+// A sizeHintPool is a ByteSlicePool that can pick a slice for a known size,
+// like BytePool and SizeClassPool.
+type sizeHintPool interface {
+	GetSize(size int) []byte
+}
+
+// get returns a byte slice of length size from the pool, using the size as a
+// hint if the pool supports it.
+func (f *Factory) get(size int) []byte {
+	if p, ok := f.pool.(sizeHintPool); ok {
+		return p.GetSize(size)[0:size]
+	}
+	return f.pool.Resize(f.pool.Get(), size)
+}
+
+// release returns a byte slice to a pool.  In debug mode, the slice is
+// poisoned and kept out of the pool instead.
 func (f *Factory) release(bs []byte) {
+	if f.dbg != nil {
+		poison(bs)
+		return
+	}
 	f.pool.Put(bs)
 }
 
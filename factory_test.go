@@ -7,6 +7,8 @@
 package bsony
 
 import (
+	"bytes"
+	"io"
 	"testing"
 )
 
@@ -30,17 +32,17 @@ func TestNewDocFromBytes(t *testing.T) {
 		},
 		{
 			[]byte{},
-			errShortDoc,
+			ErrShortDoc,
 			"short",
 		},
 		{
 			[]byte{5, 0, 0, 0, 0, 0},
-			errInvalidLength,
+			ErrInvalidLength,
 			"bad length",
 		},
 		{
 			[]byte{5, 0, 0, 0, 1},
-			errMissingTerminator,
+			ErrMissingTerminator,
 			"unterminated",
 		},
 	}
@@ -49,7 +51,79 @@ func TestNewDocFromBytes(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.label, func(t *testing.T) {
 			doc, err := fct.NewDocFromBytes(c.in)
-			assertErr(t, err, c.err)
+			assertErrIs(t, err, c.err)
+			if doc != nil {
+				doc.Release()
+			}
+		})
+	}
+}
+
+func TestNewDocFromReader(t *testing.T) {
+	cases := []struct {
+		in    []byte
+		docs  []string
+		err   error
+		label string
+	}{
+		{
+			[]byte{},
+			nil,
+			io.EOF,
+			"empty",
+		},
+		{
+			[]byte{5, 0, 0, 0, 0},
+			[]string{"0500000000"},
+			io.EOF,
+			"single",
+		},
+		{
+			[]byte{5, 0, 0, 0, 0, 8, 0, 0, 0, 10, 97, 0, 0},
+			[]string{"0500000000", "080000000a610000"},
+			io.EOF,
+			"concatenated",
+		},
+		{
+			[]byte{5, 0},
+			nil,
+			io.ErrUnexpectedEOF,
+			"short length",
+		},
+		{
+			[]byte{6, 0, 0, 0, 0},
+			nil,
+			io.ErrUnexpectedEOF,
+			"truncated",
+		},
+		{
+			[]byte{4, 0, 0, 0},
+			nil,
+			ErrInvalidLength,
+			"bad length",
+		},
+		{
+			[]byte{5, 0, 0, 0, 1},
+			nil,
+			ErrMissingTerminator,
+			"unterminated",
+		},
+	}
+
+	fct := New()
+	for _, c := range cases {
+		t.Run(c.label, func(t *testing.T) {
+			r := bytes.NewReader(c.in)
+			for _, want := range c.docs {
+				doc, err := fct.NewDocFromReader(r)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				compareDocHex(t, doc, want, c.label)
+				doc.Release()
+			}
+			doc, err := fct.NewDocFromReader(r)
+			assertErrIs(t, err, c.err)
 			if doc != nil {
 				doc.Release()
 			}
@@ -64,3 +138,32 @@ func TestNewArray(t *testing.T) {
 	compareArrayHex(t, ary, "0500000000", "new array")
 	ary.Release()
 }
+
+func TestNewArrayFromBytes(t *testing.T) {
+	fct := New()
+	src := fct.NewArray(int32(1), "b")
+	buf := make([]byte, src.Len())
+	src.CopyTo(buf)
+	src.Release()
+
+	a, err := fct.NewArrayFromBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add(true)
+	want := fct.NewArray(int32(1), "b", true)
+	compareDocs(t, a.d, want.d, "continued indices")
+	a.Release()
+	want.Release()
+
+	// Element with a string length running past the end of the array.  The
+	// buffer goes back to the pool.
+	pool := NewBytePool(0, 1024)
+	_, err = NewFromPool(pool).NewArrayFromBytes([]byte{0x0c, 0, 0, 0, 0x02, 0x30, 0, 0x10, 0, 0, 0, 0})
+	if err == nil {
+		t.Error("expected error for corrupt element")
+	}
+	if s := pool.Stats(); s.Puts != 1 {
+		t.Errorf("expected buffer returned to pool, got %d puts", s.Puts)
+	}
+}
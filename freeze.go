@@ -0,0 +1,76 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import "sync/atomic"
+
+// Freeze makes the document read-only and reference counted, so it can be
+// shared by many goroutines, e.g. as a decoded configuration or a cache
+// entry, and returned to the pool when the last one is done with it.  It
+// returns the document.
+//
+// The caller holds the first reference.  Each additional holder, typically
+// one per goroutine, takes a reference with Retain before sharing starts and
+// drops it with Release.  Reading a frozen document, e.g. with Iter, Get,
+// CopyTo or String, is safe for concurrent use.  Adding to a frozen document
+// fails like adding to any immutable document, recording an error, and must
+// not be done concurrently with other use.  A Clone of a frozen document is
+// an ordinary, mutable document.
+//
+// Freeze has no effect on a document that is already frozen, on an immutable
+// view of another document's bytes, or on a released document.
+// In an Arena, Close releases the creator's reference to a frozen document,
+// so the creator must not also Release it.
+func (d *Doc) Freeze() *Doc {
+	if d.immutable || !d.valid {
+		return d
+	}
+	d.immutable = true
+	d.frozen = true
+	d.refs = 1
+	return d
+}
+
+// Frozen reports whether the document has been frozen with Freeze.
+func (d *Doc) Frozen() bool {
+	return d.frozen
+}
+
+// Retain takes another reference to a frozen document and returns the
+// document.  It panics if the document isn't frozen or its last reference
+// has been released, since either is a bug in the caller.
+func (d *Doc) Retain() *Doc {
+	if !d.frozen {
+		panic("bsony: Retain of document that is not frozen")
+	}
+	for {
+		n := atomic.LoadInt32(&d.refs)
+		if n <= 0 {
+			panic("bsony: Retain of released document")
+		}
+		if atomic.CompareAndSwapInt32(&d.refs, n, n+1) {
+			return d
+		}
+	}
+}
+
+// Freeze makes the array read-only and reference counted, as for Doc.Freeze.
+func (a *Array) Freeze() *Array {
+	a.d.Freeze()
+	return a
+}
+
+// Frozen reports whether the array has been frozen with Freeze.
+func (a *Array) Frozen() bool {
+	return a.d.frozen
+}
+
+// Retain takes another reference to a frozen array, as for Doc.Retain.
+func (a *Array) Retain() *Array {
+	a.d.Retain()
+	return a
+}
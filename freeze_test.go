@@ -0,0 +1,127 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	f := NewFromPool(pool)
+	d := f.NewDoc().AddInt32("a", 1).Freeze()
+	if !d.Frozen() {
+		t.Fatal("doc not frozen")
+	}
+	if d.Freeze() != d || !d.Frozen() {
+		t.Error("second Freeze changed doc")
+	}
+
+	d.AddInt32("b", 2)
+	assertErr(t, d.Err(), ErrImmutable)
+	compareDocHex(t, d, "0c0000001061000100000000", "frozen doc unchanged")
+
+	clone := d.Clone()
+	if clone.Frozen() {
+		t.Error("clone of frozen doc is frozen")
+	}
+	clone.AddInt32("b", 2)
+	if clone.Err() != nil {
+		t.Errorf("clone not mutable: %v", clone.Err())
+	}
+	clone.Release()
+
+	puts := pool.Stats().Puts
+	d.Retain().Retain()
+	d.Release()
+	d.Release()
+	if !d.Valid() || pool.Stats().Puts != puts {
+		t.Fatal("frozen doc released before last reference")
+	}
+	d.Release()
+	if d.Valid() || pool.Stats().Puts != puts+1 {
+		t.Fatal("frozen doc not released with last reference")
+	}
+	assertErr(t, d.Err(), ErrBufferReleased)
+
+	// Extra releases have no effect, as for an ordinary document.
+	d.Release()
+	if pool.Stats().Puts != puts+1 {
+		t.Error("extra release returned buffer again")
+	}
+}
+
+func TestFreezeArray(t *testing.T) {
+	a := New().NewArray(int32(1)).Freeze()
+	if !a.Frozen() {
+		t.Fatal("array not frozen")
+	}
+	a.AddInt32(2)
+	assertErr(t, a.Err(), ErrImmutable)
+	a.Retain().Release()
+	if !a.Valid() {
+		t.Fatal("array released before last reference")
+	}
+	a.Release()
+	if a.Valid() {
+		t.Fatal("array not released with last reference")
+	}
+}
+
+func TestRetainPanics(t *testing.T) {
+	assertPanics(t, "Retain unfrozen", func() { New().NewDoc().Retain() }, "not frozen")
+
+	d := New().NewDoc().Freeze()
+	d.Release()
+	assertPanics(t, "Retain released", func() { d.Retain() }, "released document")
+
+	d = New().WithDebug(nil).NewDoc().Freeze()
+	d.Retain()
+	d.Release()
+	d.Release()
+	assertPanics(t, "over-release in debug mode", d.Release, "released twice")
+}
+
+func TestFreezeConcurrent(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	d := NewFromPool(pool).NewDoc().AddString("a", "b").AddInt32("c", 1).Freeze()
+
+	const readers = 16
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		d.Retain()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer d.Release()
+			for j := 0; j < 100; j++ {
+				iter := d.Iter()
+				n := 0
+				for iter.Next() {
+					if iter.Get() == nil {
+						t.Error("nil value")
+					}
+					n++
+				}
+				if n != 2 {
+					t.Errorf("wrong element count: %d", n)
+				}
+				_ = d.String()
+			}
+		}()
+	}
+	d.Release()
+	wg.Wait()
+
+	if d.Valid() {
+		t.Error("frozen doc not released by last reader")
+	}
+	if s := pool.Stats(); s.Puts != 1 {
+		t.Errorf("expected one Put, got %d", s.Puts)
+	}
+}
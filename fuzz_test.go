@@ -0,0 +1,125 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package bsony
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+// FuzzNewDocFromBytes checks that no input can crash parsing, iteration or
+// decoding.  It is seeded from the corpus, e.g.
+//
+//	go test -run=^$ -fuzz=FuzzNewDocFromBytes
+func FuzzNewDocFromBytes(f *testing.F) {
+	addCorpusSeeds(f)
+	fct := New()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := make([]byte, len(data))
+		copy(buf, data)
+		d, err := fct.NewDocFromBytes(buf)
+		if err != nil {
+			return
+		}
+		defer d.Release()
+		exerciseDoc(d)
+		_ = d.String()
+		_ = d.DebugString()
+		_ = Walk(d, func([]string, Value) WalkAction { return WalkContinue })
+		if cp, err := Transform(d, func([]string, Value) Change { return Change{} }); err == nil {
+			cp.Release()
+		}
+	})
+}
+
+// FuzzNewValueUnsafe checks that no value bytes can crash parsing or
+// decoding a value of any type.
+func FuzzNewValueUnsafe(f *testing.F) {
+	f.Add(byte(TypeCodeWithScope), []byte{14, 0, 0, 0, 1, 0, 0, 0, 0, 5, 0, 0, 0, 0})
+	f.Add(byte(TypeBinary), []byte{4, 0, 0, 0, 2, 0, 0, 0, 0})
+	f.Add(byte(TypeEmbeddedDocument), []byte{5, 0, 0, 0, 0})
+	fct := New()
+	f.Fuzz(func(t *testing.T, bt byte, data []byte) {
+		v := newValueUnsafe(fct, data, Type(bt))
+		if x, ok := v.Get().(interface{ Release() }); ok {
+			x.Release()
+		}
+		_ = v.String()
+		if sub, err := v.DocUnsafe(); err == nil {
+			exerciseDoc(sub)
+		}
+		if cs, err := v.CodeScopeUnsafe(); err == nil {
+			exerciseDoc(cs.Scope)
+		}
+	})
+}
+
+// exerciseDoc iterates d fully, decoding every value and descending into
+// views of nested documents.  The depth is bounded by the input size.
+func exerciseDoc(d *Doc) {
+	iter := d.Iter()
+	for iter.Next() {
+		_ = iter.Key()
+		v := iter.vu
+		if x, ok := v.Get().(interface{ Release() }); ok {
+			x.Release()
+		}
+		if cs, ok := v.Get().(CodeWithScope); ok && cs.Scope != nil {
+			cs.Scope.Release()
+		}
+		_ = v.String()
+		if sub, err := v.DocUnsafe(); err == nil {
+			exerciseDoc(sub)
+		}
+		if sub, err := v.ArrayUnsafe(); err == nil {
+			exerciseDoc(sub.d)
+		}
+		if cs, err := v.CodeScopeUnsafe(); err == nil {
+			exerciseDoc(cs.Scope)
+		}
+		if iter.Err() != nil {
+			return
+		}
+	}
+}
+
+// addCorpusSeeds adds the valid and invalid BSON of the corpus to f.
+func addCorpusSeeds(f *testing.F) {
+	files, err := ioutil.ReadDir(testDir)
+	if err != nil {
+		f.Fatal("couldn't read corpus directory")
+	}
+	for _, fi := range files {
+		if fi.IsDir() || path.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		guts, err := ioutil.ReadFile(path.Join(testDir, fi.Name()))
+		if err != nil {
+			f.Fatalf("couldn't read %s", fi.Name())
+		}
+		cases := &corpusData{}
+		json.Unmarshal(guts, cases)
+		var seeds []string
+		for _, c := range cases.Valid {
+			seeds = append(seeds, c.CanonicalBSON)
+		}
+		for _, c := range cases.DecodeErrors {
+			seeds = append(seeds, c.Bson)
+		}
+		for _, s := range seeds {
+			if b, err := hex.DecodeString(s); err == nil {
+				f.Add(b)
+			}
+		}
+	}
+}
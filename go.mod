@@ -1,5 +1,3 @@
 module github.com/xdg-go/bsony
 
 go 1.14
-
-require go.mongodb.org/mongo-driver v1.4.0
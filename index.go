@@ -0,0 +1,78 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+// A keyIndex maps the keys of a document to the offsets of their elements.
+type keyIndex struct {
+	offsets map[string]int
+}
+
+// Index builds an index of the keys of d, if it doesn't have one, and
+// returns d.  Lookup then finds keys in constant time rather than by
+// scanning the document, which pays off for repeated lookups on wide
+// documents.  The index is dropped when an element is added.  Elements after
+// one that can't be parsed aren't indexed.
+//
+// Index and Lookup are safe for concurrent use on a frozen document.
+func (d *Doc) Index() *Doc {
+	if !d.valid || d.loadIndex() != nil {
+		return d
+	}
+	idx := &keyIndex{offsets: make(map[string]int)}
+	iter := d.Iter()
+	for iter.Next() {
+		k := iter.keyBytes()
+		if _, ok := idx.offsets[string(k)]; !ok {
+			idx.offsets[string(k)] = iter.offset
+		}
+	}
+	d.index.Store(idx)
+	return d
+}
+
+// Lookup returns the value of the first element of d with key k and whether
+// one was found.  It uses the index built by Index, if any, and otherwise
+// scans the document.  The value has an error if it can't be parsed.
+//
+// WARNING: the value directly references the underlying data, as for
+// DocIter.ValueUnsafe: (1) you MUST NOT modify its bytes; (2) you MUST NOT
+// keep it beyond the lifetime of the document or past any call that adds to
+// it.
+func (d *Doc) Lookup(k string) (Value, bool) {
+	if !d.valid {
+		return nil, false
+	}
+	if idx := d.loadIndex(); idx != nil {
+		offset, ok := idx.offsets[k]
+		if !ok {
+			return nil, false
+		}
+		iter := &DocIter{d: d, offset: offset}
+		iter.parseNextValue()
+		return iter.vu, true
+	}
+	iter := d.Iter()
+	for iter.Next() {
+		if string(iter.keyBytes()) == k {
+			return iter.vu, true
+		}
+	}
+	return nil, false
+}
+
+// loadIndex returns the index of d or nil if it has none.
+func (d *Doc) loadIndex() *keyIndex {
+	idx, _ := d.index.Load().(*keyIndex)
+	return idx
+}
+
+// dropIndex discards the index of d, if any, after d changes.
+func (d *Doc) dropIndex() {
+	if d.loadIndex() != nil {
+		d.index.Store((*keyIndex)(nil))
+	}
+}
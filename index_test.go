@@ -0,0 +1,123 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	fct := New()
+	d := wideDoc(fct, 40).AddString("k3", "duplicate")
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			d.Index()
+		}
+		for _, k := range []string{"k0", "k3", "k39"} {
+			v, ok := d.Lookup(k)
+			if !ok {
+				t.Errorf("indexed %v: %s not found", indexed, k)
+				continue
+			}
+			want, _ := strconv.Atoi(k[1:])
+			if got := v.Get(); got != int32(want) {
+				t.Errorf("indexed %v: %s is %v, want %d", indexed, k, got, want)
+			}
+		}
+		if v, ok := d.Lookup("k40"); ok || v != nil {
+			t.Errorf("indexed %v: found missing key", indexed)
+		}
+	}
+
+	// Adding drops the index, so new keys are found.
+	d.AddString("k40", "new")
+	if d.loadIndex() != nil {
+		t.Error("index not dropped by Add")
+	}
+	d.Index()
+	if v, ok := d.Lookup("k40"); !ok || v.Get() != "new" {
+		t.Errorf("wrong value for added key: %v", v)
+	}
+	d.Release()
+	if _, ok := d.Lookup("k0"); ok {
+		t.Error("found key in released document")
+	}
+}
+
+func TestLookupCorrupt(t *testing.T) {
+	fct := New()
+	d := fct.NewDoc().AddInt32("a", 1).AddString("b", "xy").AddInt32("c", 3)
+	// Corrupt the length of the string "b".
+	d.buf[16] = 0x7f
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			d.Index()
+		}
+		if v, ok := d.Lookup("b"); !ok || v.Err() == nil {
+			t.Errorf("indexed %v: expected error for b, got %v", indexed, v)
+		}
+		if _, ok := d.Lookup("c"); ok {
+			t.Errorf("indexed %v: found c after corrupt value", indexed)
+		}
+	}
+	d.Release()
+}
+
+func TestIndexFrozenConcurrent(t *testing.T) {
+	d := wideDoc(New(), 100).Freeze()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(d *Doc) {
+			defer wg.Done()
+			defer d.Release()
+			for i := 0; i < 100; i++ {
+				k := "k" + strconv.Itoa(i)
+				if v, ok := d.Index().Lookup(k); !ok || v.Get() != int32(i) {
+					t.Errorf("wrong value for %s: %v", k, v)
+				}
+			}
+		}(d.Retain())
+	}
+	wg.Wait()
+	d.Release()
+}
+
+// BenchmarkLookup compares looking up the middle key of documents of
+// different widths by scanning, with an index, and building an index for a
+// single lookup.  An indexed lookup beats a scan at any width, but building
+// the index costs several scans, so it pays off only for documents looked up
+// repeatedly: the crossover is the ratio of build to scan.
+func BenchmarkLookup(b *testing.B) {
+	fct := New()
+	for _, n := range []int{4, 8, 16, 32, 64, 128, 256} {
+		d := wideDoc(fct, n)
+		k := "k" + strconv.Itoa(n/2)
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				d.Lookup(k)
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			d.Index()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.Lookup(k)
+			}
+		})
+		b.Run(fmt.Sprintf("build/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				d.dropIndex()
+				d.Index().Lookup(k)
+			}
+		})
+		d.Release()
+	}
+}
@@ -17,6 +17,7 @@ type DocIter struct {
 	offset int          // start of type byte for an value or terminating null
 	keyLen int          // -1 means end-of-doc or null byte not found
 	vu     *unsafeValue // view to the value; nil if not yet parsed
+	err    error        // error that ended the iteration, if any
 }
 
 func newDocIter(d *Doc) *DocIter {
@@ -32,29 +33,35 @@ func (i *DocIter) parseNextValue() {
 		i.vu = newValueUnsafe(i.d.factory, nil, 0)
 		return
 	}
+	t := Type(i.d.buf[i.offset])
 	// Key starts after the type byte at the offset and goes to a null byte. If
 	// there is no null byte, we have a bad document and let the -1 keyLen
 	// signal the problem.
 	i.keyLen = bytes.IndexByte(i.d.buf[i.offset+1:], 0)
 	if i.keyLen == -1 {
 		i.vu = newValueUnsafe(i.d.factory, nil, 0)
+		i.err = &DecodeError{Offset: i.offset, Type: t, Err: fmt.Errorf("key %w", ErrMissingTerminator)}
 		return
 	}
 
 	// Data begins after type byte, key length and null byte
-	i.vu = newValueUnsafe(i.d.factory, i.d.buf[i.offset+i.keyLen+2:], Type(i.d.buf[i.offset]))
+	data, err := parseValue(i.d.buf[i.offset+i.keyLen+2:], t)
+	i.vu = &unsafeValue{factory: i.d.factory, t: t, data: data, src: i.d.dbg}
 
 	// If type byte, key, null and i.vu length consumes the full buffer
 	// including the terminator byte, then the i.vu has a bad internal length
-	if i.offset+i.keyLen+len(i.vu.data)+2 >= i.d.Len() {
-		i.vu.err = fmt.Errorf("invalid internal length exceeds container")
+	if err == nil && i.offset+i.keyLen+len(data)+2 >= i.d.Len() {
+		err = errorf(ErrInvalidLength, "value length %d exceeds container", len(data))
+	}
+	if err != nil {
+		i.vu.err = &DecodeError{Offset: i.offset, Path: i.Key(), Type: t, Err: err}
 	}
-
 }
 
 // Next advances the iterator, if possible.  It returns true if a value is
 // available.
 func (i *DocIter) Next() bool {
+	i.d.dbg.check("DocIter.Next")
 	// On the first call to Next(), i.vu will be nil, so we initialize it
 	// without advancing.
 	if i.vu == nil {
@@ -67,6 +74,15 @@ func (i *DocIter) Next() bool {
 		return false
 	}
 
+	// If the current value couldn't be parsed, its length is unknown, so
+	// there is no way to find the next one.
+	if i.vu.err != nil {
+		i.err = i.vu.err
+		i.keyLen = -1
+		i.vu = newValueUnsafe(i.d.factory, nil, 0)
+		return false
+	}
+
 	// The next value (or final null byte) starts after type byte, keyLen, null
 	// byte, and length of ValueUnsafe bytes
 	i.offset += i.keyLen + len(i.vu.data) + 2
@@ -89,6 +105,7 @@ func (i *DocIter) Type() Type {
 // the end of the document has been reached, the empty string will be
 // returned.
 func (i *DocIter) Key() string {
+	i.d.dbg.check("DocIter.Key")
 	if i.keyLen <= 0 {
 		return ""
 	}
@@ -96,6 +113,14 @@ func (i *DocIter) Key() string {
 	return string(i.d.buf[i.offset+1 : i.offset+i.keyLen+1])
 }
 
+// keyBytes returns the key for the current value without copying it.
+func (i *DocIter) keyBytes() []byte {
+	if i.keyLen <= 0 {
+		return nil
+	}
+	return i.d.buf[i.offset+1 : i.offset+i.keyLen+1]
+}
+
 // Value returns a copy of the current value of the iterator or nil if the
 // end of the document has been reached or if the value could not be parsed.
 // It is safe to keep the value copy and release the source document.
@@ -129,8 +154,14 @@ func (i *DocIter) Get() interface{} {
 
 // XXX Should this have methods for typed decoding?  E.g. `Int32OK`?
 
-// Err returns any error from parsing the current value of the iterator.
+// Err returns any error from parsing the current value of the iterator.  Once
+// Next returns false, it returns the error that ended the iteration, if the
+// document is corrupt.  Parsing errors are DecodeErrors with the offset of the
+// element in the document and its key.
 func (i *DocIter) Err() error {
+	if i.err != nil {
+		return i.err
+	}
 	if i.Type() == TypeInvalid {
 		return fmt.Errorf("invalid value or iterator exhausted")
 	}
@@ -0,0 +1,199 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidKey is recorded on a document when an element is added with a
+// key containing a null byte, which would corrupt the document, or with a
+// key breaking the storage rules of a factory set with WithStorageRules.
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrInvalidID is returned when a document breaks the storage rules for the
+// type of its _id.
+var ErrInvalidID = errors.New("invalid _id")
+
+// WithStorageRules makes the factory enforce the rules MongoDB applies to
+// stored documents and returns the factory.  The Add methods record
+// ErrInvalidKey instead of adding an element whose key, or any key in whose
+// embedded documents, starts with '$' or contains '.', except for the
+// "$ref", "$id" and "$db" fields of a DBRef.  NewDocFromBytes and
+// NewDocFromReader reject documents that fail ValidateStorage, as do
+// Transform and Redactor.Redact for their results.  It must be called before
+// the factory is used.
+func (f *Factory) WithStorageRules() *Factory {
+	f.storage = true
+	return f
+}
+
+// ValidateStorage checks d against the rules MongoDB applies to stored
+// documents: no key at any depth may start with '$' or contain '.', except
+// for the fields of a DBRef, and a top-level _id may not be an array, a
+// regular expression or undefined.  Keys of arrays aren't checked.  It
+// returns a DecodeError with the path to the first element breaking a rule,
+// wrapping ErrInvalidKey or ErrInvalidID, for the first element that can't be
+// parsed, or wrapping ErrTooDeep for a container nested deeper than the
+// maximum depth of the factory.
+//
+// The _id rules are only checked by ValidateStorage and by decoding, not by
+// the Add methods, since a document being built may become embedded.
+func (d *Doc) ValidateStorage() error {
+	if !d.valid {
+		return d.err
+	}
+	var c storageChecker
+	return c.checkDoc(d, 0, false, true)
+}
+
+// checkKey returns an error if k can't be written as a key.
+func checkKey(k string) error {
+	if strings.IndexByte(k, 0) >= 0 {
+		return fmt.Errorf("%w %q: contains a null byte", ErrInvalidKey, k)
+	}
+	return nil
+}
+
+// checkStorageKey returns an error if k breaks the storage rules for a key
+// following the keys in prev, which holds up to the first three keys of the
+// document.
+func checkStorageKey(k string, prev []string) error {
+	if strings.HasPrefix(k, "$") && !isDBRefKey(k, prev) {
+		return fmt.Errorf("%w %q: starts with '$'", ErrInvalidKey, k)
+	}
+	if strings.IndexByte(k, '.') >= 0 {
+		return fmt.Errorf("%w %q: contains '.'", ErrInvalidKey, k)
+	}
+	return nil
+}
+
+// isDBRefKey reports whether k is a field of a DBRef after the keys in prev:
+// "$ref" first, then "$id", then optionally "$db".
+func isDBRefKey(k string, prev []string) bool {
+	switch k {
+	case "$ref":
+		return len(prev) == 0
+	case "$id":
+		return len(prev) == 1 && prev[0] == "$ref"
+	case "$db":
+		return len(prev) == 2 && prev[0] == "$ref" && prev[1] == "$id"
+	}
+	return false
+}
+
+// checkID returns an error if a top-level _id can't have type t.
+func checkID(t Type) error {
+	switch t {
+	case TypeArray, TypeRegex, TypeUndefined:
+		return fmt.Errorf("%w: can't be %s", ErrInvalidID, t)
+	}
+	return nil
+}
+
+type storageChecker struct {
+	path []string
+}
+
+// checkDoc checks the elements of d, a document or array starting at offset
+// base in the top-level document, and of its embedded documents and arrays.
+func (c *storageChecker) checkDoc(d *Doc, base int, isArray, top bool) error {
+	var prev []string
+	iter := d.Iter()
+	for iter.Next() {
+		k := iter.Key()
+		c.path = append(c.path, k)
+		if err := iter.Err(); err != nil {
+			return c.error(base, iter, err)
+		}
+		var err error
+		if !isArray {
+			err = checkStorageKey(k, prev)
+		}
+		if err == nil && top && k == "_id" {
+			err = checkID(iter.Type())
+		}
+		if err != nil {
+			return c.error(base, iter, err)
+		}
+		if len(prev) < 3 {
+			prev = append(prev, k)
+		}
+		switch iter.Type() {
+		case TypeEmbeddedDocument, TypeArray:
+			sub, err := subDoc(iter.vu)
+			if err == nil {
+				err = d.factory.limits.checkDepth(len(c.path) + 1)
+			}
+			if err != nil {
+				return c.error(base, iter, err)
+			}
+			if err = c.checkDoc(sub, subOffset(base, iter, sub), iter.Type() == TypeArray, false); err != nil {
+				return err
+			}
+		}
+		c.path = c.path[:len(c.path)-1]
+	}
+	if iter.err != nil {
+		return c.error(base, iter, iter.err)
+	}
+	return nil
+}
+
+// error returns err as a DecodeError for the current element of iter, whose
+// document starts at offset base.
+func (c *storageChecker) error(base int, iter *DocIter, err error) error {
+	return elementError(base, iter, c.path, err)
+}
+
+// checkAddKey returns an error if an element with key k can't be added to d.
+func (d *Doc) checkAddKey(k string) error {
+	if err := checkKey(k); err != nil {
+		return err
+	}
+	if !d.factory.storage {
+		return nil
+	}
+	var prev []string
+	if strings.HasPrefix(k, "$") {
+		iter := d.Iter()
+		for len(prev) < 3 && iter.Next() {
+			prev = append(prev, iter.Key())
+		}
+	}
+	return checkStorageKey(k, prev)
+}
+
+// checkAddedValue returns an error if the element written at start is a
+// document or array whose keys break the storage rules of the factory.
+func (d *Doc) checkAddedValue(start int) error {
+	if !d.factory.storage {
+		return nil
+	}
+	t := Type(d.buf[start])
+	if t != TypeEmbeddedDocument && t != TypeArray {
+		return nil
+	}
+	iter := &DocIter{d: d, offset: start}
+	iter.parseNextValue()
+	sub, err := subDoc(iter.vu)
+	if err != nil {
+		return err
+	}
+	c := storageChecker{path: []string{iter.Key()}}
+	return c.checkDoc(sub, subOffset(0, iter, sub), t == TypeArray, false)
+}
+
+// truncate removes the elements of d from offset start.
+func (d *Doc) truncate(start int) {
+	d.buf = d.buf[:start+1]
+	d.buf[start] = 0
+	binary.LittleEndian.PutUint32(d.buf[0:4], uint32(len(d.buf)))
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNullByteKey(t *testing.T) {
+	fct := New()
+	adds := map[string]func(d *Doc, k string) *Doc{
+		"Add":       func(d *Doc, k string) *Doc { return d.Add(k, "x") },
+		"AddInt32":  func(d *Doc, k string) *Doc { return d.AddInt32(k, 1) },
+		"AddString": func(d *Doc, k string) *Doc { return d.AddString(k, "x") },
+		"AddNull":   func(d *Doc, k string) *Doc { return d.AddNull(k) },
+		"AddDoc":    func(d *Doc, k string) *Doc { return d.AddDoc(k, fct.NewDoc()) },
+		"AddNewOID": func(d *Doc, k string) *Doc { return d.AddNewOID(k) },
+		"AddValue": func(d *Doc, k string) *Doc {
+			return d.AddValue(k, newValueUnsafe(fct, []byte{1, 0, 0, 0}, TypeInt32))
+		},
+	}
+	for name, add := range adds {
+		d := add(fct.NewDoc(), "a\x00b")
+		assertErrIs(t, d.Err(), ErrInvalidKey)
+		compareDocHex(t, d, "0500000000", name)
+		// The error is sticky and nothing more is added.
+		d.AddInt32("a", 1).AddString("b", "x")
+		assertErrIs(t, d.Err(), ErrInvalidKey)
+		compareDocHex(t, d, "0500000000", name+" then AddInt32")
+		d.Release()
+	}
+
+	src := fct.NewDoc().AddInt32("a", 1)
+	_, err := Transform(src, func([]string, Value) Change { return Change{Key: "\x00"} })
+	assertErrIs(t, err, ErrInvalidKey)
+	src.Release()
+}
+
+func TestStorageRulesAdd(t *testing.T) {
+	fct := New().WithStorageRules()
+	for _, k := range []string{"$set", "a.b", "$id", "."} {
+		d := fct.NewDoc().AddInt32(k, 1)
+		assertErrIs(t, d.Err(), ErrInvalidKey)
+		compareDocHex(t, d, "0500000000", k)
+		d.Release()
+	}
+
+	dbref := fct.NewDoc().AddString("$ref", "coll").AddInt32("$id", 1).AddString("$db", "db")
+	if dbref.Err() != nil {
+		t.Errorf("unexpected error for DBRef: %v", dbref.Err())
+	}
+	d := fct.NewDoc().AddDoc("ref", dbref).AddString("$db", "db")
+	assertErrIs(t, d.Err(), ErrInvalidKey)
+	d.Release()
+
+	// Keys of embedded documents are checked and the element removed.
+	bad := New().NewDoc().AddInt32("ok", 1).AddDoc("x", New().NewDoc().AddInt32("$bad", 1))
+	d = fct.NewDoc().AddInt32("a", 1).AddDoc("b", bad)
+	var de *DecodeError
+	if !errors.As(d.Err(), &de) || de.Path != "b.x.$bad" {
+		t.Errorf("expected error at b.x.$bad, got %v", d.Err())
+	}
+	assertErrIs(t, d.Err(), ErrInvalidKey)
+	compareDocs(t, d, New().NewDoc().AddInt32("a", 1), "bad element removed")
+	d.Release()
+
+	d = fct.NewDoc().AddArray("a", New().NewArray(int32(1), New().NewDoc().AddInt32("x.y", 1)))
+	assertErrIs(t, d.Err(), ErrInvalidKey)
+	d.Release()
+
+	// Array keys and a nested array _id are fine; _id is only checked as a
+	// whole.
+	d = fct.NewDoc().AddArray("_id", fct.NewArray(int32(1))).
+		AddDoc("sub", fct.NewDoc().AddArray("_id", fct.NewArray(int32(2))))
+	if d.Err() != nil {
+		t.Errorf("unexpected error: %v", d.Err())
+	}
+	assertErrIs(t, d.ValidateStorage(), ErrInvalidID)
+	d.Release()
+
+	// Without storage rules, any key without a null byte is accepted.
+	d = New().NewDoc().AddInt32("$set", 1).AddInt32("a.b", 2)
+	if d.Err() != nil {
+		t.Errorf("unexpected error: %v", d.Err())
+	}
+	d.Release()
+}
+
+func TestValidateStorage(t *testing.T) {
+	fct := New()
+	cases := []struct {
+		label string
+		doc   *Doc
+		err   error
+		path  string
+	}{
+		{"valid", fct.NewDoc().AddInt32("_id", 1).AddDoc("a", fct.NewDoc().AddArray("_id", fct.NewArray())), nil, ""},
+		{"array _id", fct.NewDoc().AddArray("_id", fct.NewArray()), ErrInvalidID, "_id"},
+		{"regex _id", fct.NewDoc().AddInt32("a", 1).AddRegex("_id", Regex{Pattern: "x"}), ErrInvalidID, "_id"},
+		{"undefined _id", fct.NewDoc().AddUndefined("_id"), ErrInvalidID, "_id"},
+		{"dollar key", fct.NewDoc().AddInt32("$x", 1), ErrInvalidKey, "$x"},
+		{"dotted key", fct.NewDoc().AddDoc("a", fct.NewDoc().AddInt32("b.c", 1)), ErrInvalidKey, "a.b.c"},
+		{"in array", fct.NewDoc().AddArray("a", fct.NewArray(fct.NewDoc().AddInt32("$x", 1))), ErrInvalidKey, "a.0.$x"},
+		{"dbref", fct.NewDoc().AddDoc("r", fct.NewDoc().AddString("$ref", "c").AddInt32("$id", 1)), nil, ""},
+		{"dbref order", fct.NewDoc().AddDoc("r", fct.NewDoc().AddInt32("$id", 1).AddString("$ref", "c")), ErrInvalidKey, "r.$id"},
+	}
+	for _, c := range cases {
+		err := c.doc.ValidateStorage()
+		if c.err == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.label, err)
+			}
+			c.doc.Release()
+			continue
+		}
+		var de *DecodeError
+		if !errors.Is(err, c.err) || !errors.As(err, &de) || de.Path != c.path {
+			t.Errorf("%s: expected '%v' at %s, got '%v'", c.label, c.err, c.path, err)
+		}
+
+		// Decoding applies the same rules.
+		buf := make([]byte, c.doc.Len())
+		c.doc.CopyTo(buf)
+		_, err = New().WithStorageRules().NewDocFromBytes(buf)
+		assertErrIs(t, err, c.err)
+		c.doc.Release()
+	}
+}
+
+func TestStorageRulesTransform(t *testing.T) {
+	fct := New().WithStorageRules()
+	src := fct.NewDoc().AddString("name", "Ann").AddArray("tags", fct.NewArray("a"))
+	_, err := Transform(src, func(path []string, _ Value) Change {
+		if path[0] == "tags" && len(path) == 1 {
+			return Change{Key: "_id"}
+		}
+		return Change{}
+	})
+	var de *DecodeError
+	if !errors.Is(err, ErrInvalidID) || !errors.As(err, &de) || de.Path != "_id" {
+		t.Errorf("expected invalid _id, got %v", err)
+	}
+	src.Release()
+
+	// The Add methods don't check _id, but the redacted copy is.
+	src = fct.NewDoc().AddArray("_id", fct.NewArray(int32(1))).AddString("password", "x")
+	_, err = NewRedactor().Keys("password").Redact(src)
+	assertErrIs(t, err, ErrInvalidID)
+	src.Release()
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLarge is returned when a document exceeds the maximum size or
+// number of elements of its factory.
+var ErrTooLarge = errors.New("document exceeds size limit")
+
+// ErrTooDeep is returned when a document exceeds the maximum nesting depth
+// of its factory.
+var ErrTooDeep = errors.New("document exceeds nesting depth limit")
+
+// DefaultMaxDepth is the maximum nesting depth of documents from a factory
+// unless set with WithMaxDepth.  It matches the nesting limit of the MongoDB
+// server.
+const DefaultMaxDepth = 100
+
+// limits are the decoding limits of a factory.  A zero size or number of
+// elements means unlimited, and a zero depth means DefaultMaxDepth.
+type limits struct {
+	maxSize     int
+	maxDepth    int
+	maxElements int
+}
+
+// WithMaxSize limits documents decoded by NewDocFromBytes and
+// NewDocFromReader to n bytes and returns the factory.  Larger documents are
+// rejected with ErrTooLarge before a buffer is allocated for them.  It must
+// be called before the factory is used.  Zero, the default, means no limit.
+func (f *Factory) WithMaxSize(n int) *Factory {
+	f.limits.maxSize = n
+	return f
+}
+
+// WithMaxDepth limits the nesting depth of documents and returns the
+// factory.  The elements of a top-level document are at depth 1, and each
+// embedded document, array or code with scope scope adds one.  Deeper
+// documents are rejected with ErrTooDeep by NewDocFromBytes and
+// NewDocFromReader, and Walk, Transform and ValidateStorage stop with
+// ErrTooDeep rather than descend further, so nesting can't exhaust the
+// stack.  String and DebugString mark where they stop.  It must be called
+// before the factory is used.  Zero or less means DefaultMaxDepth, the
+// default.
+func (f *Factory) WithMaxDepth(n int) *Factory {
+	f.limits.maxDepth = n
+	return f
+}
+
+// WithMaxElements limits the total number of elements at all depths of
+// documents decoded by NewDocFromBytes and NewDocFromReader and returns the
+// factory.  Documents with more are rejected with ErrTooLarge.  It must be
+// called before the factory is used.  Zero, the default, means no limit.
+func (f *Factory) WithMaxElements(n int) *Factory {
+	f.limits.maxElements = n
+	return f
+}
+
+// checkSize returns ErrTooLarge if a document of n bytes exceeds the maximum
+// size.
+func (l limits) checkSize(n int) error {
+	if l.maxSize > 0 && n > l.maxSize {
+		return fmt.Errorf("%w: %d bytes exceeds maximum of %d", ErrTooLarge, n, l.maxSize)
+	}
+	return nil
+}
+
+// checkDepth returns ErrTooDeep if values at depth exceed the maximum depth.
+func (l limits) checkDepth(depth int) error {
+	max := l.maxDepth
+	if max <= 0 {
+		max = DefaultMaxDepth
+	}
+	if depth > max {
+		return fmt.Errorf("%w: depth %d exceeds maximum of %d", ErrTooDeep, depth, max)
+	}
+	return nil
+}
+
+// checkLimits returns an error if d exceeds the maximum depth or number of
+// elements.  Values that can't be parsed end the check but aren't reported,
+// as they are reported when the document is read.
+func (l limits) checkLimits(d *Doc) error {
+	var tooLarge error
+	n := 0
+	err := Walk(d, func([]string, Value) WalkAction {
+		n++
+		if l.maxElements > 0 && n > l.maxElements {
+			tooLarge = fmt.Errorf("%w: more than the maximum of %d elements", ErrTooLarge, l.maxElements)
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	if tooLarge != nil {
+		return tooLarge
+	}
+	if errors.Is(err, ErrTooDeep) {
+		return err
+	}
+	return nil
+}
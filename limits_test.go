@@ -0,0 +1,154 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// nestedBytes returns a document with n levels of embedded documents, each
+// with the key "a", around an int32 "x", so its values are at depths 1 to n.
+func nestedBytes(n int) []byte {
+	inner := []byte{12, 0, 0, 0, byte(TypeInt32), 'x', 0, 1, 0, 0, 0, 0}
+	// Each enclosing level adds a length, type byte, key and terminator.
+	size := len(inner) + 8*(n-1)
+	buf := make([]byte, size)
+	for i := 0; i < n-1; i++ {
+		off := 7 * i
+		binary.LittleEndian.PutUint32(buf[off:], uint32(size-8*i))
+		copy(buf[off+4:], []byte{byte(TypeEmbeddedDocument), 'a', 0})
+		buf[size-1-i] = 0
+	}
+	copy(buf[7*(n-1):], inner)
+	return buf
+}
+
+func TestMaxSize(t *testing.T) {
+	pool := NewBytePool(16, -1)
+	f := NewFromPool(pool).WithMaxSize(16)
+
+	d, err := f.NewDocFromBytes([]byte{16, 0, 0, 0, 0x12, 'a', 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Release()
+
+	big := f.NewDoc().AddString("a", "this is too long")
+	_, err = f.NewDocFromBytes(big.BytesUnsafe())
+	assertErrIs(t, err, ErrTooLarge)
+
+	// A huge declared length is rejected before allocating a buffer.
+	before := pool.Stats().BytesAllocated
+	_, err = f.NewDocFromReader(bytes.NewReader([]byte{0, 0, 0, 0x40, 0}))
+	assertErrIs(t, err, ErrTooLarge)
+	if got := pool.Stats().BytesAllocated; got != before {
+		t.Errorf("allocated %d bytes for rejected document", got-before)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	f := New().WithMaxDepth(3)
+	for depth := 1; depth <= 5; depth++ {
+		buf := (nestedBytes(depth))
+		d, err := f.NewDocFromBytes(buf)
+		if depth <= 3 {
+			if err != nil {
+				t.Errorf("depth %d: %v", depth, err)
+				continue
+			}
+			d.Release()
+			continue
+		}
+		assertErrIs(t, err, ErrTooDeep)
+		_, err = f.NewDocFromReader(bytes.NewReader(buf))
+		assertErrIs(t, err, ErrTooDeep)
+	}
+
+	// Walk and Transform stop at the limit, e.g. for a document decoded by
+	// an unlimited factory and wrapped by a limited one.
+	deep := (nestedBytes(5))
+	d := f.NewDocWithCapacity(len(deep))
+	d.buf = append(d.buf[0:0], deep...)
+	n := 0
+	err := Walk(d, func([]string, Value) WalkAction { n++; return WalkContinue })
+	assertErrIs(t, err, ErrTooDeep)
+	var de *DecodeError
+	if n != 3 || !errors.As(err, &de) || de.Path != "a.a.a" {
+		t.Errorf("expected to stop after 3 values at a.a.a, got %d values and %v", n, err)
+	}
+	_, err = Transform(d, func([]string, Value) Change { return Change{} })
+	assertErrIs(t, err, ErrTooDeep)
+	d.Release()
+
+	// An Arena shares the limits.
+	_, err = f.Scope().NewDocFromBytes((nestedBytes(4)))
+	assertErrIs(t, err, ErrTooDeep)
+}
+
+func TestMaxDepthHostile(t *testing.T) {
+	// Far deeper than any real document; rejected quickly.
+	buf := (nestedBytes(100000))
+	_, err := New().WithMaxDepth(100).NewDocFromBytes(buf)
+	assertErrIs(t, err, ErrTooDeep)
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	f := New()
+	buf := nestedBytes(DefaultMaxDepth)
+	d, err := f.NewDocFromBytes(buf)
+	if err != nil {
+		t.Fatalf("depth %d: %v", DefaultMaxDepth, err)
+	}
+	d.Release()
+	_, err = f.NewDocFromBytes(nestedBytes(DefaultMaxDepth + 1))
+	assertErrIs(t, err, ErrTooDeep)
+
+	// Nothing recurses without limit over a document too deep to decode,
+	// here wrapped directly.
+	deep := nestedBytes(2000000)
+	d = f.NewDocWithCapacity(len(deep))
+	d.buf = append(d.buf[0:0], deep...)
+	defer d.Release()
+	assertErrIs(t, Walk(d, func([]string, Value) WalkAction { return WalkContinue }), ErrTooDeep)
+	_, err = Transform(d, func([]string, Value) Change { return Change{} })
+	assertErrIs(t, err, ErrTooDeep)
+	assertErrIs(t, d.ValidateStorage(), ErrTooDeep)
+	assertErrIs(t, checkDuplicateKeys(d), ErrTooDeep)
+	if got := d.StringN(-1); !strings.HasSuffix(got, ErrTooDeep.Error()+": depth 101 exceeds maximum of 100>") {
+		t.Errorf("String doesn't end with depth error: ...%s", got[len(got)-80:])
+	}
+	if got := d.DebugString(); !strings.Contains(got, "!! parse stopped: "+ErrTooDeep.Error()) {
+		t.Errorf("DebugString doesn't stop at depth limit")
+	}
+}
+
+func TestMaxElements(t *testing.T) {
+	f := New().WithMaxElements(4)
+	ok := f.NewDoc().AddInt32("a", 1).AddArray("b", f.NewArray(int32(1), int32(2)))
+	d, err := f.NewDocFromBytes(append([]byte(nil), ok.BytesUnsafe()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Release()
+
+	tooMany := ok.AddNull("c")
+	_, err = f.NewDocFromBytes(append([]byte(nil), tooMany.BytesUnsafe()...))
+	assertErrIs(t, err, ErrTooLarge)
+
+	// Parse errors aren't reported by the limit check.
+	bad := append([]byte(nil), tooMany.BytesUnsafe()...)
+	bad[4] = 0x20
+	d, err = New().WithMaxElements(1).NewDocFromBytes(bad)
+	if err != nil {
+		t.Fatalf("unexpected error for unparsable value: %v", err)
+	}
+	d.Release()
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoconv
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xdg-go/bsony"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var tDoc = reflect.TypeOf((*bsony.Doc)(nil))
+var tArray = reflect.TypeOf((*bsony.Array)(nil))
+
+// NewRegistry returns the driver's default registry with bsony codecs
+// registered as by Register.  Use it with the driver's `SetRegistry` options
+// to pass a `*bsony.Doc` directly to methods such as `Collection.InsertOne`.
+func NewRegistry(f *bsony.Factory) *bsoncodec.Registry {
+	return Register(bson.NewRegistryBuilder(), f).Build()
+}
+
+// Register adds encoders and decoders for `*bsony.Doc` and `*bsony.Array` to
+// rb and returns rb.  Encoding copies the encoded bytes directly to the
+// output.  Decoding copies the input into new documents and arrays from the
+// factory, which the caller must release.  A nil pointer encodes as BSON
+// null and BSON null decodes as a nil pointer.
+func Register(rb *bsoncodec.RegistryBuilder, f *bsony.Factory) *bsoncodec.RegistryBuilder {
+	c := &codec{f: f}
+	return rb.
+		RegisterTypeEncoder(tDoc, bsoncodec.ValueEncoderFunc(c.encodeDoc)).
+		RegisterTypeEncoder(tArray, bsoncodec.ValueEncoderFunc(c.encodeArray)).
+		RegisterTypeDecoder(tDoc, bsoncodec.ValueDecoderFunc(c.decodeDoc)).
+		RegisterTypeDecoder(tArray, bsoncodec.ValueDecoderFunc(c.decodeArray))
+}
+
+type codec struct {
+	f *bsony.Factory
+}
+
+func (c *codec) encodeDoc(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tDoc {
+		return bsoncodec.ValueEncoderError{Name: "DocEncodeValue", Types: []reflect.Type{tDoc}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+	d := val.Interface().(*bsony.Doc)
+	if !d.Valid() {
+		return fmt.Errorf("can't encode invalid document: %w", d.Err())
+	}
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, d.BytesUnsafe())
+}
+
+func (c *codec) encodeArray(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tArray {
+		return bsoncodec.ValueEncoderError{Name: "ArrayEncodeValue", Types: []reflect.Type{tArray}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+	a := val.Interface().(*bsony.Array)
+	if !a.Valid() {
+		return fmt.Errorf("can't encode invalid array: %w", a.Err())
+	}
+	return bsonrw.Copier{}.CopyValueFromBytes(vw, bsontype.Array, a.BytesUnsafe())
+}
+
+func (c *codec) decodeDoc(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tDoc {
+		return bsoncodec.ValueDecoderError{Name: "DocDecodeValue", Types: []reflect.Type{tDoc}, Received: val}
+	}
+	if vr.Type() == bsontype.Null {
+		val.Set(reflect.Zero(tDoc))
+		return vr.ReadNull()
+	}
+	buf, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+	d, err := c.f.NewDocFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(d))
+	return nil
+}
+
+func (c *codec) decodeArray(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tArray {
+		return bsoncodec.ValueDecoderError{Name: "ArrayDecodeValue", Types: []reflect.Type{tArray}, Received: val}
+	}
+	switch vr.Type() {
+	case bsontype.Null:
+		val.Set(reflect.Zero(tArray))
+		return vr.ReadNull()
+	case bsontype.Array:
+	default:
+		return fmt.Errorf("can't decode %s into *bsony.Array", vr.Type())
+	}
+	_, buf, err := bsonrw.Copier{}.CopyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+	a, err := c.f.NewArrayFromBytes(buf)
+	if err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(a))
+	return nil
+}
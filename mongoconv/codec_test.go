@@ -0,0 +1,117 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoconv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/xdg-go/bsony"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type wrapper struct {
+	Name  string       `bson:"name"`
+	Doc   *bsony.Doc   `bson:"doc"`
+	Array *bsony.Array `bson:"array"`
+}
+
+func TestCodec(t *testing.T) {
+	reg := NewRegistry(fct)
+
+	in := wrapper{
+		Name:  "x",
+		Doc:   fct.NewDoc().AddInt32("a", 1),
+		Array: fct.NewArray("b"),
+	}
+	defer in.Doc.Release()
+	defer in.Array.Release()
+
+	buf, err := bson.MarshalWithRegistry(reg, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{
+		{Key: "name", Value: "x"},
+		{Key: "doc", Value: bson.D{{Key: "a", Value: int32(1)}}},
+		{Key: "array", Value: bson.A{"b"}},
+	}
+	wantBuf, _ := bson.Marshal(want)
+	if !bytes.Equal(buf, wantBuf) {
+		t.Errorf("marshal struct:\nGot:  %x\nWant: %x", buf, wantBuf)
+	}
+
+	var out wrapper
+	if err := bson.UnmarshalWithRegistry(reg, buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "x" || docHex(t, out.Doc) != docHex(t, in.Doc) {
+		t.Errorf("unmarshal struct: got %s", out.Doc)
+	}
+	if out.Array.String() != in.Array.String() {
+		t.Errorf("unmarshal array: got %s", out.Array)
+	}
+	out.Array.Add("c")
+	if out.Array.String() != `[ "b", "c" ]` {
+		t.Errorf("decoded array indices incorrect: %s", out.Array)
+	}
+	out.Doc.Release()
+	out.Array.Release()
+
+	// Top-level document.
+	top, err := bson.MarshalWithRegistry(reg, in.Doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ToUpper(hex.EncodeToString(top)) != docHex(t, in.Doc) {
+		t.Errorf("marshal top-level: got %x", top)
+	}
+	var topDoc *bsony.Doc
+	if err := bson.UnmarshalWithRegistry(reg, top, &topDoc); err != nil {
+		t.Fatal(err)
+	}
+	if docHex(t, topDoc) != docHex(t, in.Doc) {
+		t.Errorf("unmarshal top-level: got %s", topDoc)
+	}
+	topDoc.Release()
+}
+
+func TestCodecNull(t *testing.T) {
+	reg := NewRegistry(fct)
+	buf, err := bson.MarshalWithRegistry(reg, wrapper{Name: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBuf, _ := bson.Marshal(bson.D{{Key: "name", Value: "x"}, {Key: "doc", Value: nil}, {Key: "array", Value: nil}})
+	if !bytes.Equal(buf, wantBuf) {
+		t.Errorf("marshal nil:\nGot:  %x\nWant: %x", buf, wantBuf)
+	}
+	out := wrapper{Doc: fct.NewDoc(), Array: fct.NewArray()}
+	if err := bson.UnmarshalWithRegistry(reg, buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Doc != nil || out.Array != nil {
+		t.Error("null didn't decode to nil")
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	reg := NewRegistry(fct)
+	d := fct.NewDoc()
+	d.Release()
+	if _, err := bson.MarshalWithRegistry(reg, wrapper{Doc: d}); err == nil {
+		t.Error("expected error encoding released document")
+	}
+
+	buf, _ := bson.Marshal(bson.D{{Key: "array", Value: "x"}})
+	var out wrapper
+	if err := bson.UnmarshalWithRegistry(reg, buf, &out); err == nil {
+		t.Error("expected error decoding string into array")
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/xdg-go/bsony/mongoconv
+
+go 1.14
+
+require (
+	github.com/xdg-go/bsony v0.0.0-20261018165313-6c9a856b5eb3
+	go.mongodb.org/mongo-driver v1.4.0
+)
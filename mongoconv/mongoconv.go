@@ -0,0 +1,126 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package mongoconv converts between bsony values and the types of the
+// MongoDB Go driver.  It is a separate module so that bsony itself has no
+// dependency on the driver.
+package mongoconv
+
+import (
+	"fmt"
+
+	"github.com/xdg-go/bsony"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FromPrimitive converts a driver `primitive` value to the equivalent bsony
+// value, suitable for `Doc.Add`.  The scope of a `primitive.CodeWithScope` is
+// marshaled with `bson.Marshal` into a new document from the factory, which
+// the caller owns and must release, e.g. once `Doc.Add` has copied it.
+// Values of other types are returned unchanged.
+func FromPrimitive(f *bsony.Factory, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case primitive.Binary:
+		return bsony.Binary{Subtype: x.Subtype, Data: x.Data}, nil
+	case *primitive.Binary:
+		return &bsony.Binary{Subtype: x.Subtype, Data: x.Data}, nil
+	case primitive.Undefined:
+		return bsony.Undefined{}, nil
+	case primitive.ObjectID:
+		return bsony.ObjectID(x), nil
+	case primitive.DateTime:
+		return bsony.DateTime(x), nil
+	case primitive.Regex:
+		return bsony.Regex{Pattern: x.Pattern, Options: x.Options}, nil
+	case *primitive.Regex:
+		return &bsony.Regex{Pattern: x.Pattern, Options: x.Options}, nil
+	case primitive.DBPointer:
+		return bsony.DBPointer{DB: x.DB, Pointer: bsony.ObjectID(x.Pointer)}, nil
+	case *primitive.DBPointer:
+		return &bsony.DBPointer{DB: x.DB, Pointer: bsony.ObjectID(x.Pointer)}, nil
+	case primitive.JavaScript:
+		return bsony.JavaScript(x), nil
+	case primitive.Symbol:
+		return bsony.Symbol(x), nil
+	case primitive.CodeWithScope:
+		buf, err := bson.Marshal(x.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling scope: %w", err)
+		}
+		scope, err := f.NewDocFromBytes(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling scope: buffer invalid: %w", err)
+		}
+		return bsony.CodeWithScope{Code: string(x.Code), Scope: scope}, nil
+	case primitive.Timestamp:
+		return bsony.Timestamp{T: x.T, I: x.I}, nil
+	case primitive.Decimal128:
+		return bsony.NewDecimal128(x.GetBytes()), nil
+	case *primitive.Decimal128:
+		d := bsony.NewDecimal128(x.GetBytes())
+		return &d, nil
+	case primitive.MinKey:
+		return bsony.MinKey{}, nil
+	case primitive.MaxKey:
+		return bsony.MaxKey{}, nil
+	default:
+		return v, nil
+	}
+}
+
+// ToPrimitive converts a bsony value, such as one returned by `Get`, to the
+// equivalent driver `primitive` value.  The scope of a `CodeWithScope` is
+// copied into a `bson.Raw`.  Values of other types are returned unchanged.
+func ToPrimitive(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case bsony.Binary:
+		return primitive.Binary{Subtype: x.Subtype, Data: x.Data}, nil
+	case *bsony.Binary:
+		return &primitive.Binary{Subtype: x.Subtype, Data: x.Data}, nil
+	case bsony.Undefined:
+		return primitive.Undefined{}, nil
+	case bsony.ObjectID:
+		return primitive.ObjectID(x), nil
+	case bsony.DateTime:
+		return primitive.DateTime(x), nil
+	case bsony.Regex:
+		return primitive.Regex{Pattern: x.Pattern, Options: x.Options}, nil
+	case *bsony.Regex:
+		return &primitive.Regex{Pattern: x.Pattern, Options: x.Options}, nil
+	case bsony.DBPointer:
+		return primitive.DBPointer{DB: x.DB, Pointer: primitive.ObjectID(x.Pointer)}, nil
+	case *bsony.DBPointer:
+		return &primitive.DBPointer{DB: x.DB, Pointer: primitive.ObjectID(x.Pointer)}, nil
+	case bsony.JavaScript:
+		return primitive.JavaScript(x), nil
+	case bsony.Symbol:
+		return primitive.Symbol(x), nil
+	case bsony.CodeWithScope:
+		scope := bson.Raw{5, 0, 0, 0, 0}
+		if x.Scope != nil {
+			if !x.Scope.Valid() {
+				return nil, fmt.Errorf("invalid scope: %w", x.Scope.Err())
+			}
+			scope = make(bson.Raw, x.Scope.Len())
+			x.Scope.CopyTo(scope)
+		}
+		return primitive.CodeWithScope{Code: primitive.JavaScript(x.Code), Scope: scope}, nil
+	case bsony.Timestamp:
+		return primitive.Timestamp{T: x.T, I: x.I}, nil
+	case bsony.Decimal128:
+		return primitive.NewDecimal128(x.GetBytes()), nil
+	case *bsony.Decimal128:
+		d := primitive.NewDecimal128(x.GetBytes())
+		return &d, nil
+	case bsony.MinKey:
+		return primitive.MinKey{}, nil
+	case bsony.MaxKey:
+		return primitive.MaxKey{}, nil
+	default:
+		return v, nil
+	}
+}
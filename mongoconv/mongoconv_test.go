@@ -0,0 +1,123 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoconv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xdg-go/bsony"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var fct = bsony.New()
+
+func docHex(t *testing.T, d *bsony.Doc) string {
+	t.Helper()
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	buf := make([]byte, d.Len())
+	d.CopyTo(buf)
+	return strings.ToUpper(hex.EncodeToString(buf))
+}
+
+func TestRoundTrip(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("56e1fc72e0c917e9c4714161")
+	dec, _ := primitive.ParseDecimal128("1.5")
+	testTime, _ := time.Parse(time.RFC3339, "2012-12-24T12:15:30.501Z")
+
+	cases := []struct {
+		label string
+		v     interface{}
+		want  string
+	}{
+		{"binary", primitive.Binary{Subtype: 1, Data: []byte{255, 255}}, "0F0000000578000200000001FFFF00"},
+		{"binary (pointer)", &primitive.Binary{Subtype: 1, Data: []byte{255, 255}}, "0F0000000578000200000001FFFF00"},
+		{"undefined", primitive.Undefined{}, "0800000006780000"},
+		{"oid", oid, "1400000007780056E1FC72E0C917E9C471416100"},
+		{"datetime", primitive.NewDateTimeFromTime(testTime), "10000000097800C5D8D6CC3B01000000"},
+		{"regex", primitive.Regex{Pattern: "abc", Options: "im"}, "0F0000000B780061626300696D0000"},
+		{"regex (pointer)", &primitive.Regex{Pattern: "abc", Options: "im"}, "0F0000000B780061626300696D0000"},
+		{"DBPointer", primitive.DBPointer{DB: "b", Pointer: oid}, "1A0000000C780002000000620056E1FC72E0C917E9C471416100"},
+		{"DBPointer (pointer)", &primitive.DBPointer{DB: "b", Pointer: oid}, "1A0000000C780002000000620056E1FC72E0C917E9C471416100"},
+		{"JavaScript", primitive.JavaScript("b"), "0E0000000D780002000000620000"},
+		{"Symbol", primitive.Symbol("b"), "0E0000000E780002000000620000"},
+		{"timestamp", primitive.Timestamp{T: 123456789, I: 42}, "100000001178002A00000015CD5B0700"},
+		{"decimal128", dec, "180000001378000F000000000000000000000000003E3000"},
+		{"decimal128 (pointer)", &dec, "180000001378000F000000000000000000000000003E3000"},
+		{"minkey", primitive.MinKey{}, "08000000FF780000"},
+		{"maxkey", primitive.MaxKey{}, "080000007F780000"},
+		{"int32 (unchanged)", int32(1), "0C0000001078000100000000"},
+	}
+
+	for _, c := range cases {
+		v, err := FromPrimitive(fct, c.v)
+		if err != nil {
+			t.Fatalf("%s: %v", c.label, err)
+		}
+		d := fct.NewDoc().Add("x", v)
+		if got := docHex(t, d); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.label, got, c.want)
+		}
+		back, err := ToPrimitive(v)
+		if err != nil {
+			t.Fatalf("%s: %v", c.label, err)
+		}
+		if !reflect.DeepEqual(back, c.v) {
+			t.Errorf("%s: round trip got %#v, want %#v", c.label, back, c.v)
+		}
+		d.Release()
+	}
+}
+
+func TestCodeWithScope(t *testing.T) {
+	cws := primitive.CodeWithScope{Code: "abcd", Scope: bson.D{{Key: "y", Value: int32(2)}}}
+	v, err := FromPrimitive(fct, cws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.(bsony.CodeWithScope).Scope.Release()
+	d := fct.NewDoc().Add("a", v)
+	defer d.Release()
+	want := "210000000F6100190000000500000061626364000C000000107900020000000000"
+	if got := docHex(t, d); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	back, err := ToPrimitive(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := back.(primitive.CodeWithScope)
+	scope, _ := bson.Marshal(cws.Scope)
+	if x.Code != cws.Code || !bytes.Equal(x.Scope.(bson.Raw), scope) {
+		t.Errorf("round trip got %#v", x)
+	}
+
+	back, err = ToPrimitive(bsony.CodeWithScope{Code: "abcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.(primitive.CodeWithScope).Scope.(bson.Raw); !bytes.Equal(got, []byte{5, 0, 0, 0, 0}) {
+		t.Errorf("nil scope converted to %x", []byte(got))
+	}
+
+	if _, err := FromPrimitive(fct, primitive.CodeWithScope{Code: "x", Scope: 42}); err == nil {
+		t.Error("expected error marshaling invalid scope")
+	}
+	released := fct.NewDoc()
+	released.Release()
+	if _, err := ToPrimitive(bsony.CodeWithScope{Code: "x", Scope: released}); err == nil {
+		t.Error("expected error converting released scope")
+	}
+}
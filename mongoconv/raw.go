@@ -0,0 +1,83 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoconv
+
+import (
+	"github.com/xdg-go/bsony"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// AsRaw returns a view of the document as a `bson.Raw` without copying.  It
+// returns nil if the document is invalid.
+//
+// WARNING: the view has the same restrictions as `Doc.BytesUnsafe`: you MUST
+// NOT modify it or keep it beyond the lifetime of the document or past any
+// call that adds to it.
+func AsRaw(d *bsony.Doc) bson.Raw {
+	return bson.Raw(d.BytesUnsafe())
+}
+
+// AsDocument returns a view of the document as a `bsoncore.Document`, with
+// the same restrictions as AsRaw.
+func AsDocument(d *bsony.Doc) bsoncore.Document {
+	return bsoncore.Document(d.BytesUnsafe())
+}
+
+// AsArray returns a view of the array as a `bsoncore.Array`, with the same
+// restrictions as AsRaw.
+func AsArray(a *bsony.Array) bsoncore.Array {
+	return bsoncore.Array(a.BytesUnsafe())
+}
+
+// NewDocFromRaw returns a document from the factory that uses raw without
+// copying.  Like `Factory.NewDocFromBytes`, the document takes ownership of
+// raw and the caller should not use it afterwards.
+func NewDocFromRaw(f *bsony.Factory, raw bson.Raw) (*bsony.Doc, error) {
+	return f.NewDocFromBytes(raw)
+}
+
+// ToD decodes the document into a `bson.D` with the driver's default
+// registry.
+func ToD(d *bsony.Doc) (bson.D, error) {
+	var out bson.D
+	if err := bson.Unmarshal(AsRaw(d), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ToM decodes the document into a `bson.M` with the driver's default
+// registry.
+func ToM(d *bsony.Doc) (bson.M, error) {
+	var out bson.M
+	if err := bson.Unmarshal(AsRaw(d), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NewDocFromD marshals a `bson.D` with the driver's default registry into a
+// new document from the factory.
+func NewDocFromD(f *bsony.Factory, v bson.D) (*bsony.Doc, error) {
+	buf, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return f.NewDocFromBytes(buf)
+}
+
+// NewDocFromM marshals a `bson.M` with the driver's default registry into a
+// new document from the factory.  As with any Go map, key order is not
+// preserved.
+func NewDocFromM(f *bsony.Factory, v bson.M) (*bsony.Doc, error) {
+	buf, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return f.NewDocFromBytes(buf)
+}
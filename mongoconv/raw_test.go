@@ -0,0 +1,82 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoconv
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRaw(t *testing.T) {
+	d := fct.NewDoc().AddInt32("a", 1).AddString("b", "c")
+	raw := AsRaw(d)
+	if &raw[0] != &d.BytesUnsafe()[0] {
+		t.Error("AsRaw copied the document")
+	}
+	if err := raw.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := raw.Lookup("b").StringValue(); got != "c" {
+		t.Errorf("lookup through view: got %q", got)
+	}
+	if err := AsDocument(d).Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := NewDocFromRaw(fct, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &back.BytesUnsafe()[0] != &raw[0] {
+		t.Error("NewDocFromRaw copied the document")
+	}
+
+	a := fct.NewArray(int32(1), "b")
+	if vals, err := AsArray(a).Values(); err != nil || len(vals) != 2 {
+		t.Errorf("AsArray values: %v, %v", vals, err)
+	}
+	a.Release()
+
+	d.Release()
+	if AsRaw(d) != nil {
+		t.Error("AsRaw of released doc should be nil")
+	}
+}
+
+func TestDM(t *testing.T) {
+	want := bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: bson.D{{Key: "c", Value: "x"}}}}
+	d, err := NewDocFromD(fct, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Release()
+	if got := docHex(t, d); got != "1D000000106100010000000362000E0000000263000200000078000000" {
+		t.Errorf("NewDocFromD: got %s", got)
+	}
+	got, err := ToD(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToD: got %#v, want %#v", got, want)
+	}
+
+	m, err := NewDocFromM(fct, bson.M{"a": int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Release()
+	gotM, err := ToM(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotM, bson.M{"a": int32(1)}) {
+		t.Errorf("ToM: got %#v", gotM)
+	}
+}
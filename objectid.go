@@ -0,0 +1,135 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// An ObjectID is a 12-byte BSON ObjectID: a 4-byte big-endian timestamp in
+// seconds since the Unix epoch, a 5-byte value unique to the process and a
+// 3-byte big-endian counter.
+type ObjectID [12]byte
+
+// NilObjectID is the zero ObjectID.
+var NilObjectID ObjectID
+
+var errObjectIDHex = errors.New("invalid ObjectID hex string")
+var errObjectIDExtJSON = errors.New("invalid ObjectID Extended JSON")
+
+// oidProcessUnique and oidCounter are initialized randomly once per process,
+// so IDs generated by different processes in the same second don't collide.
+var oidProcessUnique = processUnique()
+var oidCounter = randomUint32()
+
+// NewObjectID returns a new ObjectID for the current time.
+func NewObjectID() ObjectID {
+	return NewObjectIDFromTime(time.Now())
+}
+
+// NewObjectIDFromTime returns a new ObjectID for the given time.  Only the
+// seconds since the Unix epoch are used.
+func NewObjectIDFromTime(t time.Time) ObjectID {
+	var id ObjectID
+	putNewObjectID(id[:], t)
+	return id
+}
+
+// putNewObjectID writes a new ObjectID for time t into the first 12 bytes of
+// b.
+func putNewObjectID(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()))
+	copy(b[4:9], oidProcessUnique[:])
+	c := atomic.AddUint32(&oidCounter, 1)
+	b[9], b[10], b[11] = byte(c>>16), byte(c>>8), byte(c)
+}
+
+func processUnique() [5]byte {
+	var b [5]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Errorf("can't initialize ObjectID generator: %w", err))
+	}
+	return b
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Errorf("can't initialize ObjectID generator: %w", err))
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// ObjectIDFromHex parses a 24-character hexadecimal string.
+func ObjectIDFromHex(s string) (ObjectID, error) {
+	var id ObjectID
+	if len(s) != 24 {
+		return id, fmt.Errorf("%w: %q", errObjectIDHex, s)
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return NilObjectID, fmt.Errorf("%w: %q", errObjectIDHex, s)
+	}
+	return id, nil
+}
+
+// ObjectIDFromExtJSON parses an Extended JSON ObjectID, e.g.
+// `{"$oid":"56e1fc72e0c917e9c4714161"}`.
+func ObjectIDFromExtJSON(b []byte) (ObjectID, error) {
+	var v map[string]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return NilObjectID, fmt.Errorf("%w: %v", errObjectIDExtJSON, err)
+	}
+	s, ok := v["$oid"]
+	if !ok || len(v) != 1 {
+		return NilObjectID, fmt.Errorf("%w: %s", errObjectIDExtJSON, bytes.TrimSpace(b))
+	}
+	return ObjectIDFromHex(s)
+}
+
+// Timestamp returns the time encoded in the ObjectID.
+func (id ObjectID) Timestamp() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(id[0:4])), 0)
+}
+
+// IsZero reports whether id is NilObjectID.
+func (id ObjectID) IsZero() bool {
+	return id == NilObjectID
+}
+
+// Hex returns the ObjectID as a 24-character hexadecimal string.
+func (id ObjectID) Hex() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String returns the ObjectID like the mongo shell, e.g.
+// `ObjectId("56e1fc72e0c917e9c4714161")`.
+func (id ObjectID) String() string {
+	return `ObjectId("` + id.Hex() + `")`
+}
+
+// MarshalJSON returns the ObjectID as canonical Extended JSON.
+func (id ObjectID) MarshalJSON() ([]byte, error) {
+	return []byte(`{"$oid":"` + id.Hex() + `"}`), nil
+}
+
+// UnmarshalJSON parses an Extended JSON ObjectID.
+func (id *ObjectID) UnmarshalJSON(b []byte) error {
+	x, err := ObjectIDFromExtJSON(b)
+	if err != nil {
+		return err
+	}
+	*id = x
+	return nil
+}
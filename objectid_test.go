@@ -0,0 +1,114 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewObjectID(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	a := NewObjectIDFromTime(now)
+	b := NewObjectIDFromTime(now)
+	if a == b {
+		t.Fatalf("consecutive ObjectIDs are equal: %s", a.Hex())
+	}
+	if !a.Timestamp().Equal(now) {
+		t.Errorf("timestamp incorrect: got %v, want %v", a.Timestamp(), now)
+	}
+	if a.Hex()[8:18] != b.Hex()[8:18] {
+		t.Errorf("process unique bytes differ: %s, %s", a.Hex(), b.Hex())
+	}
+	ca := int(a[9])<<16 | int(a[10])<<8 | int(a[11])
+	cb := int(b[9])<<16 | int(b[10])<<8 | int(b[11])
+	if (ca+1)&0xffffff != cb {
+		t.Errorf("counter didn't increment: %06x, %06x", ca, cb)
+	}
+
+	id := NewObjectID()
+	if d := time.Since(id.Timestamp()); d < 0 || d > time.Minute {
+		t.Errorf("NewObjectID timestamp not current: %v", id.Timestamp())
+	}
+	if id.IsZero() || !NilObjectID.IsZero() {
+		t.Error("IsZero incorrect")
+	}
+}
+
+func TestObjectIDParse(t *testing.T) {
+	const h = "56e1fc72e0c917e9c4714161"
+	id, err := ObjectIDFromHex(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Hex() != h {
+		t.Errorf("hex round trip: got %s", id.Hex())
+	}
+	if id.String() != `ObjectId("`+h+`")` {
+		t.Errorf("String incorrect: got %s", id)
+	}
+	if got := id.Timestamp().UTC().Format(time.RFC3339); got != "2016-03-10T23:00:02Z" {
+		t.Errorf("timestamp incorrect: got %s", got)
+	}
+
+	for _, s := range []string{"", "56e1fc72e0c917e9c471416", "56e1fc72e0c917e9c47141610", "56e1fc72e0c917e9c471416g"} {
+		if _, err := ObjectIDFromHex(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+
+	got, err := ObjectIDFromExtJSON([]byte(` {"$oid" : "` + h + `"} `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Errorf("ExtJSON parse: got %s", got.Hex())
+	}
+	for _, s := range []string{`"` + h + `"`, `{"$oid":"` + h + `","x":1}`, `{"$id":"` + h + `"}`, `{"$oid":"zz"}`, `{`} {
+		if _, err := ObjectIDFromExtJSON([]byte(s)); err == nil {
+			t.Errorf("expected error parsing %s", s)
+		}
+	}
+
+	out, err := json.Marshal(struct{ ID ObjectID }{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"ID":{"$oid":"`+h+`"}}` {
+		t.Errorf("MarshalJSON incorrect: got %s", out)
+	}
+	var back struct{ ID ObjectID }
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.ID != id {
+		t.Errorf("UnmarshalJSON incorrect: got %s", back.ID.Hex())
+	}
+}
+
+func TestAddNewOID(t *testing.T) {
+	d := fct.NewDoc().AddNewOID("_id")
+	defer d.Release()
+	if d.Err() != nil {
+		t.Fatal(d.Err())
+	}
+	iter := d.Iter()
+	if !iter.Next() || iter.Key() != "_id" {
+		t.Fatal("missing _id")
+	}
+	id, ok := iter.Get().(ObjectID)
+	if !ok {
+		t.Fatalf("value was %T, not ObjectID", iter.Get())
+	}
+	if d := time.Since(id.Timestamp()); d < 0 || d > time.Minute {
+		t.Errorf("timestamp not current: %v", id.Timestamp())
+	}
+	if iter.Next() {
+		t.Error("unexpected extra element")
+	}
+}
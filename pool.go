@@ -8,12 +8,16 @@ package bsony
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // A ByteSlicePool provides an abstraction for a pool of []byte objects.
 // It provides Get, Put, and Resize methods.  The Resize method allows for
 // more control over allocations than relying on the native `append` function
-// to grow slices.
+// to grow slices.  Slices from Get and the bytes added by Resize need not be
+// zeroed; documents overwrite every byte they use.  Resize must not recycle a
+// slice it replaces, as views, iterators and BytesUnsafe results may still
+// reference it.
 type ByteSlicePool interface {
 	Get() []byte
 	Put(buf []byte)
@@ -23,9 +27,69 @@ type ByteSlicePool interface {
 // A BytePool wraps a sync.Pool of byte slices, but constrains byte slices
 // created/returned to be between a minimum and maximum capacity.
 type BytePool struct {
-	pool   *sync.Pool
-	minCap int
-	maxCap int
+	// counters is first so its 64-bit fields are aligned for atomic access.
+	counters  poolCounters
+	pool      *sync.Pool
+	minCap    int
+	maxCap    int
+	observer  PoolObserver
+	zeroOnGet bool
+	wipeOnPut bool
+}
+
+// PoolStats is a snapshot of pool activity counters.  It marshals to JSON,
+// so it can be published directly with expvar.Func.
+type PoolStats struct {
+	Gets           uint64 // calls to Get
+	Puts           uint64 // calls to Put, including discards
+	Misses         uint64 // Gets that allocated a new slice
+	Discards       uint64 // slices dropped for being too large or too small
+	ResizeCopies   uint64 // Resizes that copied to a larger slice
+	BytesAllocated uint64 // capacity of newly allocated slices
+}
+
+type poolCounters struct {
+	gets, puts, misses, discards, resizeCopies, bytesAllocated uint64
+}
+
+// A PoolEvent identifies the kind of pool activity reported to a
+// PoolObserver.
+type PoolEvent int
+
+// These constants are the pool events reported to a PoolObserver.
+const (
+	PoolGet        PoolEvent = iota // Get returned a pooled slice
+	PoolMiss                        // Get allocated a new slice
+	PoolPut                         // Put returned a slice to the pool
+	PoolDiscard                     // Put or GetSize dropped a slice of the wrong size
+	PoolResizeCopy                  // Resize copied to a larger slice
+)
+
+// String returns the name of the event.
+func (e PoolEvent) String() string {
+	switch e {
+	case PoolGet:
+		return "get"
+	case PoolMiss:
+		return "miss"
+	case PoolPut:
+		return "put"
+	case PoolDiscard:
+		return "discard"
+	case PoolResizeCopy:
+		return "resize copy"
+	default:
+		return "unknown"
+	}
+}
+
+// A PoolObserver is notified of pool activity, e.g. to update metrics.  The
+// capacity is that of the slice involved; for PoolMiss and PoolResizeCopy it
+// is that of the new slice.  ObservePool is called synchronously from
+// pool methods, possibly concurrently, so it must be fast and safe for
+// concurrent use.
+type PoolObserver interface {
+	ObservePool(e PoolEvent, capacity int)
 }
 
 // NewBytePool constructs a byte slice pool with minimum and maximum capacities
@@ -42,40 +106,133 @@ func NewBytePool(minCap, maxCap int) *BytePool {
 	}
 }
 
+// WithObserver sets an observer to be notified of pool activity and returns
+// the pool.  It must be called before the pool is used.
+func (p *BytePool) WithObserver(o PoolObserver) *BytePool {
+	p.observer = o
+	return p
+}
+
+// WithZeroOnGet makes Get zero the full capacity of reused slices and
+// returns the pool.  It must be called before the pool is used.  Documents
+// don't need zeroed slices, so this is only useful when the pool is shared
+// with other code that does.
+func (p *BytePool) WithZeroOnGet() *BytePool {
+	p.zeroOnGet = true
+	return p
+}
+
+// WithWipeOnPut makes Put zero the full capacity of every slice, whether
+// pooled or discarded, and makes Resize zero slices it outgrows, so that
+// sensitive data such as credentials doesn't linger in memory after a
+// document is released.  It returns the pool and must be called before the
+// pool is used.
+func (p *BytePool) WithWipeOnPut() *BytePool {
+	p.wipeOnPut = true
+	return p
+}
+
+// Stats returns a snapshot of the pool's activity counters.  Counters are
+// read individually, so a snapshot taken while the pool is in use may be
+// slightly inconsistent.
+func (p *BytePool) Stats() PoolStats {
+	c := &p.counters
+	return PoolStats{
+		Gets:           atomic.LoadUint64(&c.gets),
+		Puts:           atomic.LoadUint64(&c.puts),
+		Misses:         atomic.LoadUint64(&c.misses),
+		Discards:       atomic.LoadUint64(&c.discards),
+		ResizeCopies:   atomic.LoadUint64(&c.resizeCopies),
+		BytesAllocated: atomic.LoadUint64(&c.bytesAllocated),
+	}
+}
+
+func (p *BytePool) observe(e PoolEvent, capacity int) {
+	if p.observer != nil {
+		p.observer.ObservePool(e, capacity)
+	}
+}
+
 // Get gives the caller a byte slice from the pool or a new byte slice with
 // the pool's configured minimum slice capacity.  The byte slice returned will
-// have its storage zeroed and have length zero.
+// have length zero.  Unless the pool was configured WithZeroOnGet, a reused
+// slice's storage holds whatever its previous user left there.
 func (p *BytePool) Get() []byte {
+	return p.GetSize(0)
+}
+
+// GetSize is like Get, but the byte slice returned has capacity of at least
+// size.  A pooled slice that is too small is discarded, as with Resize, and a
+// new slice is allocated instead; both the discard and the miss are counted.
+func (p *BytePool) GetSize(size int) []byte {
+	atomic.AddUint64(&p.counters.gets, 1)
 	bp := p.pool.Get()
+	if bp != nil && cap(bp.([]byte)) < size {
+		atomic.AddUint64(&p.counters.discards, 1)
+		p.observe(PoolDiscard, cap(bp.([]byte)))
+		bp = nil
+	}
 	if bp == nil {
-		return make([]byte, 0, p.minCap)
+		if size < p.minCap {
+			size = p.minCap
+		}
+		atomic.AddUint64(&p.counters.misses, 1)
+		atomic.AddUint64(&p.counters.bytesAllocated, uint64(size))
+		p.observe(PoolMiss, size)
+		return make([]byte, 0, size)
 	}
 	buf := bp.([]byte)
+	p.observe(PoolGet, cap(buf))
+	if p.zeroOnGet {
+		zeroCap(buf)
+	}
+	return buf[0:0]
+}
+
+// zeroCap zeroes the full capacity of buf.
+func zeroCap(buf []byte) {
 	buf = buf[0:cap(buf)]
 	for i := range buf {
 		buf[i] = 0
 	}
-	return buf[0:0]
 }
 
 // Put returns a byte slice to the pool if the capacity is less than or equal
 // to the pool's configured maximum slice capacity.
 func (p *BytePool) Put(buf []byte) {
+	atomic.AddUint64(&p.counters.puts, 1)
+	if p.wipeOnPut {
+		zeroCap(buf)
+	}
 	if p.maxCap < 0 || cap(buf) <= p.maxCap {
+		p.observe(PoolPut, cap(buf))
 		p.pool.Put(buf)
+		return
 	}
-	return
+	atomic.AddUint64(&p.counters.discards, 1)
+	p.observe(PoolDiscard, cap(buf))
 }
 
 // Resize returns a slice of the desired length.  If the underlying capacity is
-// insufficient, a copy of the slice with doubled capacity is returned.  This is
-// an intentional leaky pool abstraction, which minimizes amortized allocations
-// by avoiding recyling small slices back to the pool.
+// insufficient, a copy of the slice with doubled capacity (or the requested
+// size, if larger) is returned.  This is an intentional leaky pool
+// abstraction, which minimizes amortized allocations by avoiding recyling
+// small slices back to the pool.
 func (p *BytePool) Resize(buf []byte, size int) []byte {
-	if size < cap(buf) {
+	if size <= cap(buf) {
 		return buf[0:size]
 	}
-	temp := make([]byte, size, cap(buf)*2)
+	newCap := cap(buf) * 2
+	if newCap < size {
+		newCap = size
+	}
+	atomic.AddUint64(&p.counters.resizeCopies, 1)
+	atomic.AddUint64(&p.counters.bytesAllocated, uint64(newCap))
+	p.observe(PoolResizeCopy, newCap)
+	temp := make([]byte, size, newCap)
 	copy(temp, buf)
+	if p.wipeOnPut {
+		zeroCap(buf)
+	}
 	return temp
 }
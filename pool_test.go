@@ -0,0 +1,188 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingObserver struct {
+	sync.Mutex
+	counts map[PoolEvent]int
+	bytes  map[PoolEvent]int
+}
+
+func (r *recordingObserver) ObservePool(e PoolEvent, capacity int) {
+	r.Lock()
+	defer r.Unlock()
+	r.counts[e]++
+	r.bytes[e] += capacity
+}
+
+func TestBytePoolStats(t *testing.T) {
+	obs := &recordingObserver{counts: map[PoolEvent]int{}, bytes: map[PoolEvent]int{}}
+	p := NewBytePool(16, 64).WithObserver(obs)
+
+	buf := p.Get()
+	buf = p.Resize(buf, 10)  // fits
+	buf = p.Resize(buf, 20)  // doubles to 32
+	buf = p.Resize(buf, 100) // grows to 100
+	p.Put(buf)               // over maxCap: discarded
+	p.Put(make([]byte, 0, 32))
+	p.Get()
+
+	s := p.Stats()
+	if s.Gets != 2 || s.Puts != 2 || s.Discards != 1 || s.ResizeCopies != 2 {
+		t.Errorf("counts incorrect: %+v", s)
+	}
+	// The second Get may miss if the garbage collector emptied the pool.
+	if s.Misses < 1 || s.Misses > 2 {
+		t.Errorf("misses incorrect: %+v", s)
+	}
+	if want := uint64(16*s.Misses + 32 + 100); s.BytesAllocated != want {
+		t.Errorf("bytes allocated: got %d, want %d", s.BytesAllocated, want)
+	}
+
+	if obs.counts[PoolGet]+obs.counts[PoolMiss] != 2 || obs.counts[PoolMiss] != int(s.Misses) {
+		t.Errorf("observed gets incorrect: %v", obs.counts)
+	}
+	if obs.counts[PoolPut] != 1 || obs.bytes[PoolPut] != 32 {
+		t.Errorf("observed puts incorrect: %v, %v", obs.counts, obs.bytes)
+	}
+	if obs.counts[PoolDiscard] != 1 || obs.bytes[PoolDiscard] != 100 {
+		t.Errorf("observed discards incorrect: %v, %v", obs.counts, obs.bytes)
+	}
+	if obs.counts[PoolResizeCopy] != 2 || obs.bytes[PoolResizeCopy] != 132 {
+		t.Errorf("observed resizes incorrect: %v, %v", obs.counts, obs.bytes)
+	}
+
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back PoolStats
+	if err := json.Unmarshal(out, &back); err != nil || back != s {
+		t.Errorf("JSON round trip failed: %s", out)
+	}
+}
+
+func TestBytePoolGetSizeDiscard(t *testing.T) {
+	obs := &recordingObserver{counts: map[PoolEvent]int{}, bytes: map[PoolEvent]int{}}
+	p := NewBytePool(16, -1).WithObserver(obs)
+
+	p.Put(make([]byte, 0, 16))
+	if buf := p.GetSize(40); cap(buf) != 40 {
+		t.Errorf("GetSize(40): got cap %d", cap(buf))
+	}
+
+	// The garbage collector may empty the pool, in which case there is
+	// nothing to discard.
+	s := p.Stats()
+	if s.Gets != 1 || s.Misses != 1 || s.Discards > 1 || s.BytesAllocated != 40 {
+		t.Errorf("counts incorrect: %+v", s)
+	}
+	if obs.counts[PoolDiscard] != int(s.Discards) || obs.bytes[PoolDiscard] != 16*int(s.Discards) {
+		t.Errorf("observed discards incorrect: %v, %v", obs.counts, obs.bytes)
+	}
+	if obs.counts[PoolMiss] != 1 || obs.bytes[PoolMiss] != 40 {
+		t.Errorf("observed misses incorrect: %v, %v", obs.counts, obs.bytes)
+	}
+}
+
+func TestBytePoolStatsConcurrent(t *testing.T) {
+	p := NewBytePool(8, -1)
+	fct := NewFromPool(p)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fct.NewDoc().AddString("k", "a longer string value").Release()
+			}
+		}()
+	}
+	wg.Wait()
+	s := p.Stats()
+	if s.Gets != 800 || s.Puts != 800 {
+		t.Errorf("counts incorrect: %+v", s)
+	}
+}
+
+func TestBytePoolZeroing(t *testing.T) {
+	testPoolZeroing(t, func() ByteSlicePool { return NewBytePool(16, -1).WithZeroOnGet() },
+		func() ByteSlicePool { return NewBytePool(16, -1).WithWipeOnPut() })
+
+	// Resize wipes the slice it outgrows.
+	p := NewBytePool(16, -1).WithWipeOnPut()
+	buf := p.Resize(p.Get(), 16)
+	copy(buf, strings.Repeat("x", 16))
+	old := buf
+	buf = p.Resize(buf, 40)
+	if !bytes.Equal(old, make([]byte, 16)) {
+		t.Errorf("outgrown slice not wiped: %x", old)
+	}
+	if string(buf[:16]) != strings.Repeat("x", 16) {
+		t.Errorf("contents not copied: %x", buf)
+	}
+}
+
+// testPoolZeroing checks the zero-on-get and wipe-on-put modes of pools with
+// 16-byte slices.
+func testPoolZeroing(t *testing.T, zeroOnGet, wipeOnPut func() ByteSlicePool) {
+	t.Helper()
+	secret := []byte(strings.Repeat("x", 16))
+
+	p := zeroOnGet()
+	buf := p.Resize(p.Get(), 16)
+	copy(buf, secret)
+	p.Put(buf)
+	// The garbage collector may empty the pool, but a reused slice must be
+	// zeroed.
+	if got := p.Get()[:16]; !bytes.Equal(got, make([]byte, 16)) {
+		t.Errorf("slice not zeroed on get: %x", got)
+	}
+
+	p = wipeOnPut()
+	buf = p.Resize(p.Get(), 16)
+	copy(buf, secret)
+	p.Put(buf)
+	if !bytes.Equal(buf, make([]byte, 16)) {
+		t.Errorf("slice not wiped on put: %x", buf)
+	}
+}
+
+// A dirtyPool hands out slices full of garbage, to check that documents
+// don't rely on zeroed storage.
+type dirtyPool struct{}
+
+func (dirtyPool) Get() []byte {
+	return dirty(make([]byte, 0, 16))
+}
+
+func (dirtyPool) Put(buf []byte) {}
+
+func (dirtyPool) Resize(buf []byte, size int) []byte {
+	if size <= cap(buf) {
+		return buf[0:size]
+	}
+	temp := dirty(make([]byte, 0, size*2))[0:size]
+	copy(temp, buf)
+	return temp
+}
+
+func dirty(buf []byte) []byte {
+	full := buf[0:cap(buf)]
+	for i := range full {
+		full[i] = 0xAA
+	}
+	return buf
+}
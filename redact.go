@@ -0,0 +1,210 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+)
+
+// DefaultRedactionMask replaces redacted values unless another mask is set.
+const DefaultRedactionMask = "REDACTED"
+
+// A RedactMode says what a Redactor does with a matched value.
+type RedactMode int
+
+// Redaction modes
+const (
+	// RedactMask replaces values with a fixed string.
+	RedactMask RedactMode = iota
+	// RedactHash replaces values with a string holding a hash of their
+	// type and bytes, so equal values can still be correlated.
+	RedactHash
+	// RedactRemove omits values.
+	RedactRemove
+)
+
+// A Redactor makes copies of documents with sensitive values masked, e.g. for
+// logging.  Values are matched by key, by dotted path, by glob pattern over
+// the path or by BSON type; a matched document or array is redacted as a
+// whole.  Structure and field order are otherwise preserved.  Removing an
+// array element renumbers the rest.
+//
+// A Redactor is configured with chained setters, which must be called before
+// it is used; after that, it is safe for concurrent use.
+type Redactor struct {
+	keys  map[string]bool
+	paths map[string]bool
+	globs [][]string // patterns split into path segments
+	types map[Type]bool
+	mode  RedactMode
+	mask  string
+	key   []byte // HMAC key for RedactHash; nil for plain SHA-256
+	err   error  // first configuration error
+}
+
+// NewRedactor returns a Redactor that matches nothing and masks values with
+// DefaultRedactionMask.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		keys:  make(map[string]bool),
+		paths: make(map[string]bool),
+		types: make(map[Type]bool),
+		mask:  DefaultRedactionMask,
+	}
+}
+
+// Keys redacts values whose key is any of names, at any depth, and returns
+// the Redactor.
+func (r *Redactor) Keys(names ...string) *Redactor {
+	for _, k := range names {
+		r.keys[k] = true
+	}
+	return r
+}
+
+// Paths redacts values at any of the dotted paths, e.g. "user.ssn", and
+// returns the Redactor.  Array elements have their index as key, e.g.
+// "cards.0".
+func (r *Redactor) Paths(paths ...string) *Redactor {
+	for _, p := range paths {
+		r.paths[p] = true
+	}
+	return r
+}
+
+// Globs redacts values whose dotted path matches any of the patterns and
+// returns the Redactor.  Each segment of a pattern is matched against one
+// key with path.Match syntax, e.g. "users.*.password", and a segment of
+// "**" matches any number of keys, e.g. "**.token".  An invalid pattern is
+// reported by Redact.
+func (r *Redactor) Globs(patterns ...string) *Redactor {
+	for _, p := range patterns {
+		segs := strings.Split(p, ".")
+		for _, s := range segs {
+			if _, err := path.Match(s, ""); err != nil && r.err == nil {
+				r.err = fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+			}
+		}
+		r.globs = append(r.globs, segs)
+	}
+	return r
+}
+
+// Types redacts values of any of the BSON types and returns the Redactor.
+func (r *Redactor) Types(types ...Type) *Redactor {
+	for _, t := range types {
+		r.types[t] = true
+	}
+	return r
+}
+
+// WithMask makes the Redactor replace values with mask and returns the
+// Redactor.
+func (r *Redactor) WithMask(mask string) *Redactor {
+	r.mode = RedactMask
+	r.mask = mask
+	return r
+}
+
+// WithHash makes the Redactor replace values with a hex-encoded hash of their
+// type and bytes and returns the Redactor.  If key is not empty, the hash is
+// an HMAC-SHA-256 with that key, which should be kept secret so low-entropy
+// values can't be recovered by guessing; otherwise it is a plain SHA-256.
+func (r *Redactor) WithHash(key []byte) *Redactor {
+	r.mode = RedactHash
+	r.key = key
+	return r
+}
+
+// WithRemove makes the Redactor omit values and returns the Redactor.
+func (r *Redactor) WithRemove() *Redactor {
+	r.mode = RedactRemove
+	return r
+}
+
+// Redact returns a redacted copy of d from the factory of d.  It returns an
+// error if the Redactor is misconfigured, a value of d can't be parsed or the
+// copy fails the checks Transform makes on its result.
+func (r *Redactor) Redact(d *Doc) (*Doc, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return Transform(d, func(keys []string, v Value) Change {
+		if !r.match(keys, v.Type()) {
+			return Change{}
+		}
+		switch r.mode {
+		case RedactRemove:
+			return Change{Action: TransformDrop}
+		case RedactHash:
+			return Change{Action: TransformReplace, Value: r.hash(v)}
+		default:
+			return Change{Action: TransformReplace, Value: r.mask}
+		}
+	})
+}
+
+// match reports whether the value with type t at the path given by keys is
+// to be redacted.
+func (r *Redactor) match(keys []string, t Type) bool {
+	if r.keys[keys[len(keys)-1]] || r.types[t] {
+		return true
+	}
+	if len(r.paths) > 0 && r.paths[strings.Join(keys, ".")] {
+		return true
+	}
+	for _, g := range r.globs {
+		if matchGlob(g, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches keys against pattern segments, one key per segment except
+// for "**".
+func matchGlob(pattern, keys []string) bool {
+	if len(pattern) == 0 {
+		return len(keys) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(keys); i++ {
+			if matchGlob(pattern[1:], keys[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], keys[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], keys[1:])
+}
+
+// hash returns the hex-encoded hash of the type and bytes of v.
+func (r *Redactor) hash(v Value) string {
+	var h hash.Hash
+	if len(r.key) > 0 {
+		h = hmac.New(sha256.New, r.key)
+	} else {
+		h = sha256.New()
+	}
+	buf := make([]byte, 1+v.Len())
+	buf[0] = byte(v.Type())
+	v.CopyTo(buf[1:])
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
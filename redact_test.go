@@ -0,0 +1,123 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	fct := New()
+	src := fct.NewDoc().
+		AddString("name", "Ann").
+		AddString("password", "hunter2").
+		AddDoc("user", fct.NewDoc().AddString("ssn", "123").AddString("password", "x").AddInt32("age", 30)).
+		AddArray("cards", fct.NewArray(
+			fct.NewDoc().AddString("number", "4111").AddString("token", "t1"),
+			fct.NewDoc().AddString("number", "5500"),
+		)).
+		AddBinary("blob", &Binary{Data: []byte{1}})
+	defer src.Release()
+
+	cases := []struct {
+		label string
+		r     *Redactor
+		want  *Doc
+	}{
+		{
+			label: "keys",
+			r:     NewRedactor().Keys("password"),
+			want: fct.NewDoc().
+				AddString("name", "Ann").
+				AddString("password", "REDACTED").
+				AddDoc("user", fct.NewDoc().AddString("ssn", "123").AddString("password", "REDACTED").AddInt32("age", 30)).
+				AddArray("cards", fct.NewArray(
+					fct.NewDoc().AddString("number", "4111").AddString("token", "t1"),
+					fct.NewDoc().AddString("number", "5500"),
+				)).
+				AddBinary("blob", &Binary{Data: []byte{1}}),
+		},
+		{
+			label: "paths, globs and types with mask",
+			r:     NewRedactor().Paths("user.ssn").Globs("cards.*.number", "**.token").Types(TypeBinary).WithMask("***"),
+			want: fct.NewDoc().
+				AddString("name", "Ann").
+				AddString("password", "hunter2").
+				AddDoc("user", fct.NewDoc().AddString("ssn", "***").AddString("password", "x").AddInt32("age", 30)).
+				AddArray("cards", fct.NewArray(
+					fct.NewDoc().AddString("number", "***").AddString("token", "***"),
+					fct.NewDoc().AddString("number", "***"),
+				)).
+				AddString("blob", "***"),
+		},
+		{
+			label: "remove whole subtrees",
+			r:     NewRedactor().Paths("user", "cards.0").WithRemove(),
+			want: fct.NewDoc().
+				AddString("name", "Ann").
+				AddString("password", "hunter2").
+				AddArray("cards", fct.NewArray(fct.NewDoc().AddString("number", "5500"))).
+				AddBinary("blob", &Binary{Data: []byte{1}}),
+		},
+	}
+
+	for _, c := range cases {
+		got, err := c.r.Redact(src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.label, err)
+		}
+		compareDocs(t, got, c.want, c.label)
+		got.Release()
+		c.want.Release()
+	}
+}
+
+func TestRedactorHash(t *testing.T) {
+	fct := New()
+	src := fct.NewDoc().AddString("a", "x").AddString("b", "x").AddString("c", "y")
+	defer src.Release()
+
+	// The value hashed is the type byte and value bytes of the string "x".
+	raw := []byte{byte(TypeString), 2, 0, 0, 0, 'x', 0}
+	plain := sha256.Sum256(raw)
+	mac := hmac.New(sha256.New, []byte("k"))
+	mac.Write(raw)
+
+	for _, c := range []struct {
+		label string
+		key   []byte
+		want  string
+	}{
+		{"sha256", nil, hex.EncodeToString(plain[:])},
+		{"hmac", []byte("k"), hex.EncodeToString(mac.Sum(nil))},
+	} {
+		got, err := NewRedactor().Keys("a", "b", "c").WithHash(c.key).Redact(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter := got.Iter()
+		var hashes []interface{}
+		for iter.Next() {
+			hashes = append(hashes, iter.Get())
+		}
+		if len(hashes) != 3 || hashes[0] != c.want || hashes[1] != c.want || hashes[2] == c.want {
+			t.Errorf("%s: wrong hashes: %v", c.label, hashes)
+		}
+		got.Release()
+	}
+}
+
+func TestRedactorBadGlob(t *testing.T) {
+	d := New().NewDoc()
+	defer d.Release()
+	_, err := NewRedactor().Globs("a.[").Redact(d)
+	assertErrIs(t, err, path.ErrBadPattern)
+}
@@ -0,0 +1,345 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultStringLimit is the maximum length in bytes of the String output of
+// documents, arrays and values.  Longer output is truncated and ends with
+// "...".  Use a StringN method for a different limit.
+const DefaultStringLimit = 1024
+
+const shellDateFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// String returns the document formatted like the mongo shell, e.g. `{ "a" :
+// NumberLong(1) }`, truncated to DefaultStringLimit bytes.
+func (d *Doc) String() string {
+	return d.StringN(DefaultStringLimit)
+}
+
+// StringN is like String, but truncates to max bytes.  If max is negative,
+// output is not truncated.
+func (d *Doc) StringN(max int) string {
+	if !d.valid {
+		return invalidString("document", d.err)
+	}
+	w := &shellWriter{max: max}
+	w.writeDoc(d.factory, d.buf, false, 1)
+	return w.String()
+}
+
+// String returns the array formatted like the mongo shell, e.g. `[ 1, "a" ]`,
+// truncated to DefaultStringLimit bytes.
+func (a *Array) String() string {
+	return a.StringN(DefaultStringLimit)
+}
+
+// StringN is like String, but truncates to max bytes.  If max is negative,
+// output is not truncated.
+func (a *Array) StringN(max int) string {
+	if !a.d.valid {
+		return invalidString("array", a.d.err)
+	}
+	w := &shellWriter{max: max}
+	w.writeDoc(a.d.factory, a.d.buf, true, 1)
+	return w.String()
+}
+
+// invalidString returns the String output for an invalid document or array,
+// which has no error if it is a zero value.
+func invalidString(kind string, err error) string {
+	if err == nil {
+		return "<invalid " + kind + ">"
+	}
+	return "<invalid " + kind + ": " + err.Error() + ">"
+}
+
+// String returns the value formatted like the mongo shell, truncated to
+// DefaultStringLimit bytes.
+func (v *unsafeValue) String() string {
+	v.src.check("Value.String")
+	w := &shellWriter{max: DefaultStringLimit}
+	w.writeValue(v, 0)
+	return w.String()
+}
+
+// A shellWriter accumulates mongo shell style output up to a limit.  Once the
+// limit is exceeded, writers stop traversing, so huge documents are cheap to
+// print.
+type shellWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *shellWriter) full() bool {
+	return w.max >= 0 && len(w.buf) > w.max
+}
+
+// room returns the number of bytes that can be written before the output is
+// truncated, or -1 if it is unlimited.  Writing them all makes the writer
+// full.
+func (w *shellWriter) room() int {
+	if w.max < 0 {
+		return -1
+	}
+	if n := w.max + 1 - len(w.buf); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// writeBytes writes as much of b as there is room for.
+func (w *shellWriter) writeBytes(b []byte) {
+	if n := w.room(); n >= 0 && len(b) > n {
+		b = b[:n]
+	}
+	w.buf = append(w.buf, b...)
+}
+
+// writeQuoted writes s as a double-quoted JSON string, stopping once the
+// writer is full.
+func (w *shellWriter) writeQuoted(s []byte) {
+	w.buf = append(w.buf, '"')
+	for _, c := range s {
+		if w.full() {
+			return
+		}
+		w.buf = appendQuotedByte(w.buf, c)
+	}
+	w.buf = append(w.buf, '"')
+}
+
+// writeBase64 writes b in base64, encoding only as much as there is room for.
+func (w *shellWriter) writeBase64(b []byte) {
+	// Each 3 bytes encode to 4.
+	if n := w.room(); n >= 0 && len(b) > n/4*3+3 {
+		b = b[:n/4*3+3]
+	}
+	offset := len(w.buf)
+	w.buf = append(w.buf, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+	base64.StdEncoding.Encode(w.buf[offset:], b)
+}
+
+func (w *shellWriter) String() string {
+	if !w.full() {
+		return string(w.buf)
+	}
+	// Don't cut a multi-byte character in half.
+	n := w.max
+	for n > 0 && !utf8.RuneStart(w.buf[n]) {
+		n--
+	}
+	return string(w.buf[:n]) + "..."
+}
+
+// writeDoc writes a document or array whose elements are at the given depth
+// and returns false if it stopped early, at a value that couldn't be parsed
+// or at the limit.
+func (w *shellWriter) writeDoc(f *Factory, buf []byte, isArray bool, depth int) bool {
+	open, close := "{", " }"
+	if isArray {
+		open, close = "[", " ]"
+	}
+	w.buf = append(w.buf, open...)
+	d := &Doc{factory: f, buf: buf, valid: true, immutable: true}
+	iter := d.Iter()
+	for n := 0; iter.Next(); n++ {
+		if n > 0 {
+			w.buf = append(w.buf, ',')
+		}
+		w.buf = append(w.buf, ' ')
+		if !isArray {
+			w.writeQuoted(iter.keyBytes())
+			w.buf = append(w.buf, " : "...)
+		}
+		if !w.writeValue(iter.vu, depth) || w.full() {
+			return false
+		}
+	}
+	w.buf = append(w.buf, close...)
+	return true
+}
+
+// writeError writes an error marker.
+func (w *shellWriter) writeError(err error) {
+	w.buf = append(w.buf, "<error: "...)
+	w.buf = append(w.buf, err.Error()...)
+	w.buf = append(w.buf, '>')
+}
+
+// writeValue writes a value at the given depth and returns false if the
+// value, or a value nested in it, couldn't be parsed or was nested too deep,
+// in which case an error marker is written instead and writing stops there.
+func (w *shellWriter) writeValue(v *unsafeValue, depth int) bool {
+	if v.err != nil {
+		w.writeError(v.err)
+		return false
+	}
+
+	switch v.t {
+	case TypeEmbeddedDocument, TypeArray, TypeCodeWithScope:
+		if err := v.factory.limits.checkDepth(depth + 1); err != nil {
+			w.writeError(err)
+			return false
+		}
+	}
+
+	switch v.t {
+	case TypeEmbeddedDocument:
+		return w.writeDoc(v.factory, v.data, false, depth+1)
+	case TypeArray:
+		return w.writeDoc(v.factory, v.data, true, depth+1)
+	case TypeCodeWithScope:
+		strLen, _ := readInt32(v.data, 4)
+		w.buf = append(w.buf, "Code("...)
+		w.writeQuoted(v.data[8 : 8+strLen-1])
+		if w.full() {
+			return false
+		}
+		w.buf = append(w.buf, ", "...)
+		if !w.writeDoc(v.factory, v.data[8+strLen:], false, depth+1) {
+			return false
+		}
+		w.buf = append(w.buf, ')')
+		return true
+	}
+	if w.writeLarge(v) {
+		return true
+	}
+
+	switch x := v.Get().(type) {
+	case float64:
+		w.buf = appendShellDouble(w.buf, x)
+	case Undefined:
+		w.buf = append(w.buf, "undefined"...)
+	case ObjectID:
+		w.buf = append(w.buf, x.String()...)
+	case bool:
+		w.buf = strconv.AppendBool(w.buf, x)
+	case time.Time:
+		x = x.UTC()
+		if x.Year() < 0 || x.Year() > 9999 {
+			w.buf = append(w.buf, "new Date("...)
+			w.buf = strconv.AppendInt(w.buf, x.Unix()*1000+int64(x.Nanosecond()/1e6), 10)
+			w.buf = append(w.buf, ')')
+			break
+		}
+		w.buf = append(w.buf, "ISODate(\""...)
+		w.buf = x.AppendFormat(w.buf, shellDateFormat)
+		w.buf = append(w.buf, "\")"...)
+	case nil:
+		w.buf = append(w.buf, "null"...)
+	case int32:
+		w.buf = strconv.AppendInt(w.buf, int64(x), 10)
+	case Timestamp:
+		w.buf = append(w.buf, "Timestamp("...)
+		w.buf = strconv.AppendUint(w.buf, uint64(x.T), 10)
+		w.buf = append(w.buf, ", "...)
+		w.buf = strconv.AppendUint(w.buf, uint64(x.I), 10)
+		w.buf = append(w.buf, ')')
+	case int64:
+		w.buf = append(w.buf, "NumberLong("...)
+		w.buf = strconv.AppendInt(w.buf, x, 10)
+		w.buf = append(w.buf, ')')
+	case Decimal128:
+		w.buf = append(w.buf, "NumberDecimal(\""...)
+		w.buf = append(w.buf, x.String()...)
+		w.buf = append(w.buf, "\")"...)
+	case MinKey:
+		w.buf = append(w.buf, "MinKey"...)
+	case MaxKey:
+		w.buf = append(w.buf, "MaxKey"...)
+	}
+	return true
+}
+
+// writeLarge writes a value of a type that can be arbitrarily large, such as
+// a string or binary, straight from its bytes, so only as much of it as there
+// is room for is copied.  It returns false for other types.
+func (w *shellWriter) writeLarge(v *unsafeValue) bool {
+	switch v.t {
+	case TypeString:
+		w.writeQuoted(v.data[4 : len(v.data)-1])
+	case TypeJavaScript, TypeSymbol:
+		if v.t == TypeJavaScript {
+			w.buf = append(w.buf, "Code("...)
+		} else {
+			w.buf = append(w.buf, "Symbol("...)
+		}
+		w.writeQuoted(v.data[4 : len(v.data)-1])
+		w.buf = append(w.buf, ')')
+	case TypeBinary:
+		subtype := v.data[4]
+		payload := v.data[5:]
+		// Legacy subtype 2 has another length after the subtype byte.
+		if subtype == 2 {
+			payload = payload[4:]
+		}
+		w.buf = append(w.buf, "BinData("...)
+		w.buf = strconv.AppendInt(w.buf, int64(subtype), 10)
+		w.buf = append(w.buf, ",\""...)
+		w.writeBase64(payload)
+		w.buf = append(w.buf, "\")"...)
+	case TypeRegex:
+		// The pattern and options are null-terminated.
+		end := bytes.IndexByte(v.data, 0)
+		w.buf = append(w.buf, '/')
+		w.writeBytes(v.data[:end])
+		w.buf = append(w.buf, '/')
+		w.writeBytes(v.data[end+1 : len(v.data)-1])
+	case TypeDBPointer:
+		strLen, _ := readInt32(v.data, 0)
+		w.buf = append(w.buf, "DBPointer("...)
+		w.writeQuoted(v.data[4 : 4+strLen-1])
+		w.buf = append(w.buf, ", ObjectId(\""...)
+		var id ObjectID
+		copy(id[:], v.data[4+strLen:])
+		w.buf = append(w.buf, id.Hex()...)
+		w.buf = append(w.buf, "\"))"...)
+	default:
+		return false
+	}
+	return true
+}
+
+func appendShellDouble(dst []byte, f float64) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(dst, "NaN"...)
+	case math.IsInf(f, 1):
+		return append(dst, "Infinity"...)
+	case math.IsInf(f, -1):
+		return append(dst, "-Infinity"...)
+	}
+	return strconv.AppendFloat(dst, f, 'g', -1, 64)
+}
+
+const lowerHex = "0123456789abcdef"
+
+// appendQuotedByte appends c escaped for a double-quoted JSON string.
+func appendQuotedByte(dst []byte, c byte) []byte {
+	switch {
+	case c == '"' || c == '\\':
+		return append(dst, '\\', c)
+	case c == '\n':
+		return append(dst, '\\', 'n')
+	case c == '\r':
+		return append(dst, '\\', 'r')
+	case c == '\t':
+		return append(dst, '\\', 't')
+	case c < 0x20:
+		return append(dst, '\\', 'u', '0', '0', lowerHex[c>>4], lowerHex[c&0xf])
+	}
+	return append(dst, c)
+}
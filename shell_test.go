@@ -0,0 +1,184 @@
+package bsony
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDocString(t *testing.T) {
+	fct := New()
+	testOID, _ := ObjectIDFromHex("56e1fc72e0c917e9c4714161")
+	testTime, _ := time.Parse(rfc3339Milli, "2012-12-24T12:15:30.501Z")
+	testDecimal128, _ := ParseDecimal128("1.5")
+
+	cases := []struct {
+		label string
+		v     interface{}
+		want  string
+	}{
+		{"double", 1.5, `1.5`},
+		{"double (integral)", 2.0, `2`},
+		{"string", "a\"b\n", `"a\"b\n"`},
+		{"doc", fct.NewDoc().AddInt32("x", 1), `{ "x" : 1 }`},
+		{"empty doc", fct.NewDoc(), `{ }`},
+		{"array", fct.NewArray(int32(1), "b"), `[ 1, "b" ]`},
+		{"binary", Binary{Subtype: 4, Data: []byte{1, 2, 3}}, `BinData(4,"AQID")`},
+		{"undefined", Undefined{}, `undefined`},
+		{"oid", testOID, `ObjectId("56e1fc72e0c917e9c4714161")`},
+		{"boolean", true, `true`},
+		{"datetime", testTime, `ISODate("2012-12-24T12:15:30.501Z")`},
+		{"datetime (out of range)", time.Unix(253402300800, 0), `new Date(253402300800000)`},
+		{"null", nil, `null`},
+		{"regex", Regex{Pattern: "abc", Options: "im"}, `/abc/im`},
+		{"DBPointer", DBPointer{DB: "b", Pointer: testOID}, `DBPointer("b", ObjectId("56e1fc72e0c917e9c4714161"))`},
+		{"JavaScript", JavaScript("x()"), `Code("x()")`},
+		{"Symbol", Symbol("s"), `Symbol("s")`},
+		{"Code with scope", CodeWithScope{Code: "x()", Scope: fct.NewDoc().AddInt32("y", 2)}, `Code("x()", { "y" : 2 })`},
+		{"int32", int32(-1), `-1`},
+		{"timestamp", Timestamp{T: 123456789, I: 42}, `Timestamp(123456789, 42)`},
+		{"int64", int64(1), `NumberLong(1)`},
+		{"decimal128", testDecimal128, `NumberDecimal("1.5")`},
+		{"minkey", MinKey{}, `MinKey`},
+		{"maxkey", MaxKey{}, `MaxKey`},
+	}
+
+	for _, c := range cases {
+		d := fct.NewDoc().Add("a", c.v)
+		want := `{ "a" : ` + c.want + ` }`
+		if got := d.String(); got != want {
+			t.Errorf("%s: Doc.String incorrect.\nGot:  %s\nWant: %s", c.label, got, want)
+		}
+		if got := fmt.Sprintf("%v", d); got != want {
+			t.Errorf("%s: %%v incorrect.\nGot:  %s\nWant: %s", c.label, got, want)
+		}
+		iter := d.Iter()
+		iter.Next()
+		if got := fmt.Sprint(iter.ValueUnsafe()); got != c.want {
+			t.Errorf("%s: Value.String incorrect.\nGot:  %s\nWant: %s", c.label, got, c.want)
+		}
+		d.Release()
+	}
+}
+
+func TestArrayString(t *testing.T) {
+	fct := New()
+	a := fct.NewArray(int32(1), fct.NewArray(), fct.NewDoc().AddNull("n"))
+	want := `[ 1, [ ], { "n" : null } ]`
+	if got := a.String(); got != want {
+		t.Errorf("Array.String incorrect.\nGot:  %s\nWant: %s", got, want)
+	}
+	if got := fmt.Sprintf("%v", a); got != want {
+		t.Errorf("%%v incorrect.\nGot:  %s\nWant: %s", got, want)
+	}
+	a.Release()
+}
+
+func TestStringNestedError(t *testing.T) {
+	fct := New()
+	cases := []struct {
+		label  string
+		d      *Doc
+		offset int
+		want   string
+	}{
+		{"doc", fct.NewDoc().AddDoc("a", fct.NewDoc().AddString("x", "xy")), 14, `{ "a" : { "x" : <error: `},
+		{"array", fct.NewDoc().AddArray("a", fct.NewArray("xy")), 14, `{ "a" : [ <error: `},
+		{"code with scope", fct.NewDoc().AddCodeScope("a", CodeWithScope{Code: "f", Scope: fct.NewDoc().AddString("x", "xy")}), 24, `{ "a" : Code("f", { "x" : <error: `},
+	}
+	for _, c := range cases {
+		d := c.d.AddInt32("b", 1)
+		// Corrupt the length of the nested string, so writing stops there
+		// and no braces are closed.
+		d.buf[c.offset] = 0x7f
+		got := d.String()
+		if !strings.HasPrefix(got, c.want) || !strings.HasSuffix(got, ">") {
+			t.Errorf("%s: String incorrect.\nGot:  %s\nWant: %s...>", c.label, got, c.want)
+		}
+		d.Release()
+	}
+}
+
+func TestStringLargeValues(t *testing.T) {
+	fct := New()
+	big := strings.Repeat("x", 4<<20)
+	cases := []struct {
+		label  string
+		v      interface{}
+		prefix string
+	}{
+		{"string", big, `{ "a" : "xxx`},
+		{"binary", Binary{Data: []byte(big)}, `{ "a" : BinData(0,"eHh4`},
+		{"binary (old)", Binary{Subtype: 2, Data: []byte(big)}, `{ "a" : BinData(2,"eHh4`},
+		{"JavaScript", JavaScript(big), `{ "a" : Code("xxx`},
+		{"Symbol", Symbol(big), `{ "a" : Symbol("xxx`},
+		{"regex", Regex{Pattern: big}, `{ "a" : /xxx`},
+		{"DBPointer", DBPointer{DB: big}, `{ "a" : DBPointer("xxx`},
+	}
+	for _, c := range cases {
+		d := fct.NewDoc().Add("a", c.v)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		got := d.StringN(80)
+		runtime.ReadMemStats(&after)
+		if len(got) != 83 || !strings.HasPrefix(got, c.prefix) || !strings.HasSuffix(got, "...") {
+			t.Errorf("%s: StringN(80) incorrect: %s", c.label, got)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 64<<10 {
+			t.Errorf("%s: StringN(80) allocated %d bytes", c.label, n)
+		}
+		d.Release()
+	}
+
+	// Untruncated output is the same as decoding the value.
+	d := fct.NewDoc().AddBinary("a", &Binary{Subtype: 2, Data: []byte("abcd")}).AddRegex("r", Regex{Pattern: "p", Options: "i"})
+	if got, want := d.StringN(-1), `{ "a" : BinData(2,"YWJjZA=="), "r" : /p/i }`; got != want {
+		t.Errorf("StringN(-1) incorrect.\nGot:  %s\nWant: %s", got, want)
+	}
+	d.Release()
+}
+
+func TestStringZeroValue(t *testing.T) {
+	if got := (&Doc{}).String(); got != "<invalid document>" {
+		t.Errorf("zero Doc String incorrect: %s", got)
+	}
+}
+
+func TestStringTruncation(t *testing.T) {
+	fct := New()
+	d := fct.NewDoc()
+	for i := 0; i < 1000; i++ {
+		d.AddString(fmt.Sprintf("k%d", i), "value")
+	}
+	got := d.String()
+	if len(got) != DefaultStringLimit+3 || !strings.HasSuffix(got, "...") {
+		t.Errorf("expected %d bytes ending in '...', got %d bytes: %s", DefaultStringLimit+3, len(got), got)
+	}
+	if !strings.HasPrefix(got, `{ "k0" : "value", "k1" : "value"`) {
+		t.Errorf("unexpected prefix: %s", got[:40])
+	}
+
+	got = d.StringN(10)
+	if got != `{ "k0" : "...` {
+		t.Errorf("StringN(10) incorrect: %s", got)
+	}
+
+	// Don't split a multi-byte character
+	d2 := fct.NewDoc().AddString("a", "ééééé")
+	got = d2.StringN(12)
+	if got != `{ "a" : "é...` {
+		t.Errorf("StringN(12) incorrect: %s", got)
+	}
+
+	if got := d.StringN(-1); !strings.HasSuffix(got, `"k999" : "value" }`) {
+		t.Errorf("StringN(-1) truncated output")
+	}
+
+	d.Release()
+	d2.Release()
+	if got := d.String(); got != "<invalid document: buffer released>" {
+		t.Errorf("released doc String incorrect: %s", got)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// A TransformAction tells Transform what to write for a value.
+type TransformAction int
+
+// Transform actions
+const (
+	// TransformKeep copies the value.  The elements of a document, array or
+	// code with scope scope are transformed in turn.
+	TransformKeep TransformAction = iota
+	// TransformSkip copies the value's bytes as they are, without
+	// transforming the elements of a container.
+	TransformSkip
+	// TransformReplace writes a new value instead.
+	TransformReplace
+	// TransformDrop omits the value.
+	TransformDrop
+)
+
+// A Change is the result of a TransformFunc.  The zero Change keeps the value
+// unchanged.
+type Change struct {
+	Action TransformAction
+	// Key, if not empty, renames the value.  It is ignored for array
+	// elements, which are always numbered in order.  A key containing a
+	// null byte is an error wrapping ErrInvalidKey.
+	Key string
+	// Value is the new value for TransformReplace, of any type supported by
+	// Doc.Add.
+	Value interface{}
+}
+
+// A TransformFunc is called by Transform for each value, with the path and
+// value as for a WalkFunc, and returns the change to make.  It is subject to
+// the same restrictions as a WalkFunc.
+type TransformFunc func(path []string, v Value) Change
+
+// Transform returns a copy of src from the factory of src, with each value
+// changed as fn directs, e.g. to redact fields, rename keys or convert types.
+// Values are visited as by Walk.  Values kept or skipped are copied as raw
+// bytes without being decoded, and dropping array elements renumbers the
+// rest.  It returns the first error parsing a value, as a DecodeError with
+// the dotted path to the value and its offset in src, or a DecodeError
+// wrapping ErrTooDeep if kept values would exceed the maximum depth of the
+// factory.  The result is checked as NewDocFromBytes checks a decoded
+// document, so a rename onto an existing key is an error under
+// DuplicateKeysError, with the offset of the error in the result rather than
+// in src.  Transform panics if a replacement value isn't supported by
+// Doc.Add.
+func Transform(src *Doc, fn TransformFunc) (*Doc, error) {
+	if !src.valid {
+		return nil, src.err
+	}
+	t := transformer{f: src.factory, fn: fn}
+	buf := t.f.get(src.Len())[0:0]
+	buf, err := t.transformDoc(buf, src, 0, false)
+	if err == nil {
+		err = t.f.limits.checkSize(len(buf))
+	}
+	if err == nil {
+		err = t.f.check(t.f.view(buf))
+	}
+	if err != nil {
+		t.f.release(buf)
+		return nil, err
+	}
+	return t.f.newDoc(buf), nil
+}
+
+type transformer struct {
+	f    *Factory
+	fn   TransformFunc
+	path []string
+}
+
+// transformDoc appends the transformed document or array src, which starts at
+// offset base in the source document, to dst.
+func (t *transformer) transformDoc(dst []byte, src *Doc, base int, isArray bool) ([]byte, error) {
+	start := len(dst)
+	dst = t.grow(dst, 4)
+	n := 0
+	iter := src.Iter()
+	for iter.Next() {
+		key := iter.Key()
+		t.path = append(t.path, key)
+		if err := iter.Err(); err != nil {
+			return dst, t.error(base, iter, err)
+		}
+		c := t.fn(t.path, iter.vu)
+		if isArray {
+			key = strconv.Itoa(n)
+		} else if c.Key != "" {
+			if err := checkKey(c.Key); err != nil {
+				return dst, t.error(base, iter, err)
+			}
+			key = c.Key
+		}
+
+		var err error
+		switch c.Action {
+		case TransformDrop:
+			t.path = t.path[:len(t.path)-1]
+			continue
+		case TransformReplace:
+			dst, err = t.appendReplacement(dst, key, c.Value, base, iter)
+		case TransformSkip:
+			dst = t.appendRaw(dst, key, iter.vu)
+		default:
+			dst, err = t.appendKept(dst, key, base, iter)
+		}
+		if err != nil {
+			return dst, err
+		}
+		n++
+		t.path = t.path[:len(t.path)-1]
+	}
+	if iter.err != nil {
+		return dst, t.error(base, iter, iter.err)
+	}
+	dst = t.grow(dst, 1)
+	dst[len(dst)-1] = 0
+	binary.LittleEndian.PutUint32(dst[start:], uint32(len(dst)-start))
+	return dst, nil
+}
+
+// appendKept appends the current value of iter, kept by the TransformFunc,
+// transforming the elements of a container.  The iterated document starts at
+// offset base in the source document.
+func (t *transformer) appendKept(dst []byte, key string, base int, iter *DocIter) ([]byte, error) {
+	v := iter.vu
+	switch v.t {
+	case TypeEmbeddedDocument, TypeArray:
+		sub, err := subDoc(v)
+		if err == nil {
+			err = t.f.limits.checkDepth(len(t.path) + 1)
+		}
+		if err != nil {
+			return dst, t.error(base, iter, err)
+		}
+		dst = t.appendTypeAndKey(dst, v.t, key)
+		return t.transformDoc(dst, sub, subOffset(base, iter, sub), v.t == TypeArray)
+	case TypeCodeWithScope:
+		cs, err := v.CodeScopeUnsafe()
+		if err == nil {
+			err = t.f.limits.checkDepth(len(t.path) + 1)
+		}
+		if err != nil {
+			return dst, t.error(base, iter, err)
+		}
+		dst = t.appendTypeAndKey(dst, v.t, key)
+		// Total length, then the code string is copied as is.
+		start := len(dst)
+		codeLen := len(v.data) - 4 - cs.Scope.Len()
+		dst = t.grow(dst, 4+codeLen)
+		copy(dst[start+4:], v.data[4:4+codeLen])
+		dst, err = t.transformDoc(dst, cs.Scope, subOffset(base, iter, cs.Scope), false)
+		if err != nil {
+			return dst, err
+		}
+		binary.LittleEndian.PutUint32(dst[start:], uint32(len(dst)-start))
+		return dst, nil
+	}
+	return t.appendRaw(dst, key, v), nil
+}
+
+// appendRaw appends a copy of the bytes of v.
+func (t *transformer) appendRaw(dst []byte, key string, v *unsafeValue) []byte {
+	dst = t.appendTypeAndKey(dst, v.t, key)
+	offset := len(dst)
+	dst = t.grow(dst, len(v.data))
+	copy(dst[offset:], v.data)
+	return dst
+}
+
+// appendReplacement appends a replacement for the current value of iter,
+// encoded by Doc.Add.  The iterated document starts at offset base in the
+// source document.
+func (t *transformer) appendReplacement(dst []byte, key string, x interface{}, base int, iter *DocIter) ([]byte, error) {
+	tmp := t.f.NewDoc().Add(key, x)
+	defer tmp.Release()
+	if err := tmp.Err(); err != nil {
+		return dst, t.error(base, iter, err)
+	}
+	// Copy the element without the document length and terminator.
+	elem := tmp.buf[4 : len(tmp.buf)-1]
+	offset := len(dst)
+	dst = t.grow(dst, len(elem))
+	copy(dst[offset:], elem)
+	return dst, nil
+}
+
+// error returns err as a DecodeError for the current element of iter, whose
+// document starts at offset base.
+func (t *transformer) error(base int, iter *DocIter, err error) error {
+	return elementError(base, iter, t.path, err)
+}
+
+func (t *transformer) appendTypeAndKey(dst []byte, ty Type, key string) []byte {
+	offset := len(dst)
+	dst = t.grow(dst, 2+len(key))
+	writeTypeAndKey(dst, offset, ty, key)
+	return dst
+}
+
+// grow extends dst by n bytes via the pool.
+func (t *transformer) grow(dst []byte, n int) []byte {
+	return t.f.resize(dst, len(dst)+n)
+}
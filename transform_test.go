@@ -0,0 +1,168 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	fct := New()
+	legacy := &Binary{Subtype: 2, Data: []byte{1, 2}}
+	src := fct.NewDoc().
+		AddInt32("i", 1).
+		AddSymbol("s", "sym").
+		AddBinary("b", legacy).
+		AddString("secret", "hunter2").
+		AddArray("a", fct.NewArray(int32(2), "drop", int32(3))).
+		AddDoc("d", fct.NewDoc().AddInt32("x", 4).AddString("old", "y")).
+		AddDoc("raw", fct.NewDoc().AddInt32("x", 5)).
+		AddCodeScope("c", CodeWithScope{Code: "f", Scope: fct.NewDoc().AddInt32("z", 6)})
+	defer src.Release()
+
+	var visited []string
+	got, err := Transform(src, func(path []string, v Value) Change {
+		p := strings.Join(path, ".")
+		visited = append(visited, p)
+		switch {
+		case p == "secret" || v.Type() == TypeString && v.Get() == "drop":
+			return Change{Action: TransformDrop}
+		case p == "raw":
+			return Change{Action: TransformSkip, Key: "copied"}
+		case p == "d.old":
+			return Change{Key: "new"}
+		}
+		switch x := v.Get().(type) {
+		case int32:
+			return Change{Action: TransformReplace, Value: int64(x)}
+		case Symbol:
+			return Change{Action: TransformReplace, Value: string(x)}
+		case Binary:
+			if x.Subtype == 2 {
+				return Change{Action: TransformReplace, Value: Binary{Data: x.Data}}
+			}
+		}
+		return Change{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Release()
+
+	want := fct.NewDoc().
+		AddInt64("i", 1).
+		AddString("s", "sym").
+		AddBinary("b", &Binary{Data: []byte{1, 2}}).
+		AddArray("a", fct.NewArray(int64(2), int64(3))).
+		AddDoc("d", fct.NewDoc().AddInt64("x", 4).AddString("new", "y")).
+		AddDoc("copied", fct.NewDoc().AddInt32("x", 5)).
+		AddCodeScope("c", CodeWithScope{Code: "f", Scope: fct.NewDoc().AddInt64("z", 6)})
+	defer want.Release()
+	compareDocs(t, got, want, "transformed")
+
+	wantVisited := "i s b secret a a.0 a.1 a.2 d d.x d.old raw c c.z"
+	if strings.Join(visited, " ") != wantVisited {
+		t.Errorf("wrong paths visited:\n got %v\nwant %v", visited, wantVisited)
+	}
+
+	// Keeping everything reproduces the source.
+	same, err := Transform(src, func([]string, Value) Change { return Change{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDocs(t, same, src, "unchanged")
+	same.Release()
+}
+
+func TestTransformError(t *testing.T) {
+	fct := New()
+	doc := fct.NewDoc().AddInt32("a", 1).AddDoc("d", fct.NewDoc().AddString("x", "ab"))
+	// Corrupt the length of the string "d.x".
+	doc.buf[21] = 0x7f
+	got, err := Transform(doc, func([]string, Value) Change { return Change{} })
+	var de *DecodeError
+	if got != nil || !errors.As(err, &de) || de.Path != "d.x" || de.Offset != 18 {
+		t.Errorf("expected error for d.x at offset 18, got %v", err)
+	}
+	doc.Release()
+	_, err = Transform(doc, func([]string, Value) Change { return Change{} })
+	assertErr(t, err, ErrBufferReleased)
+}
+
+func TestTransformChecksResult(t *testing.T) {
+	rename := func(from, to string) TransformFunc {
+		return func(path []string, _ Value) Change {
+			if path[len(path)-1] == from {
+				return Change{Key: to}
+			}
+			return Change{}
+		}
+	}
+	pool := NewBytePool(0, 1024)
+
+	// A rename onto an existing key, at the top level or nested.
+	fct := NewFromPool(pool).WithDuplicateKeys(DuplicateKeysError)
+	doc := fct.NewDoc().AddInt32("a", 1).AddDoc("d", fct.NewDoc().AddInt32("x", 2).AddInt32("y", 3))
+	got, err := Transform(doc, rename("a", "d"))
+	assertErrIs(t, err, ErrDuplicateKey)
+	var de *DecodeError
+	if got != nil || !errors.As(err, &de) || de.Path != "d" || de.Offset != 11 {
+		t.Errorf("expected duplicate key d at offset 11, got %v", err)
+	}
+	puts := pool.Stats().Puts
+	_, err = Transform(doc, rename("y", "x"))
+	if !errors.As(err, &de) || de.Path != "d.x" || de.Offset != 25 {
+		t.Errorf("expected duplicate key d.x at offset 25, got %v", err)
+	}
+	if pool.Stats().Puts != puts+1 {
+		t.Error("result buffer not released after error")
+	}
+	doc.Release()
+
+	// A rename breaking the storage rules.
+	fct = New().WithStorageRules()
+	doc = fct.NewDoc().AddDoc("d", fct.NewDoc().AddInt32("x", 1))
+	_, err = Transform(doc, rename("x", "$x"))
+	assertErrIs(t, err, ErrInvalidKey)
+	if !errors.As(err, &de) || de.Path != "d.$x" {
+		t.Errorf("expected invalid key d.$x, got %v", err)
+	}
+	doc.Release()
+
+	// A replacement exceeding the maximum size.
+	fct = New().WithMaxSize(32)
+	doc = fct.NewDoc().AddInt32("a", 1)
+	_, err = Transform(doc, func([]string, Value) Change {
+		return Change{Action: TransformReplace, Value: strings.Repeat("x", 32)}
+	})
+	assertErrIs(t, err, ErrTooLarge)
+	doc.Release()
+}
+
+func TestAddValue(t *testing.T) {
+	fct := New()
+	src := fct.NewDoc().AddString("a", "b").AddDoc("d", fct.NewDoc().AddInt32("x", 1))
+	defer src.Release()
+
+	d := fct.NewDoc()
+	a := fct.NewArray()
+	iter := src.Iter()
+	for iter.Next() {
+		d.AddValue(iter.Key(), iter.ValueUnsafe())
+		a.AddValue(iter.Value())
+	}
+	compareDocs(t, d, src, "AddValue")
+	compareArrayHex(t, a, "1d0000000230000200000062000331000c000000107800010000000000", "Array.AddValue")
+
+	bad := newValueUnsafe(fct, []byte{1, 2}, TypeInt32)
+	d.AddValue("bad", bad)
+	assertErr(t, d.Err(), bad.Err())
+	d = fct.NewDoc().AddValue("x", newValueUnsafe(fct, nil, TypeInvalid))
+	assertErr(t, d.Err(), ErrInvalidValue)
+}
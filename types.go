@@ -6,6 +6,8 @@
 
 package bsony
 
+import "time"
+
 // These constants uniquely refer to each BSON type.
 const (
 	TypeInvalid          Type = 0x00
@@ -88,9 +90,64 @@ func (bt Type) String() string {
 }
 
 // A CodeWithScope represents Javascript code with an associated scope.  Unlike
-// the MongoDB Go Driver's `primitive.CodeWithScope`, the CodeWithScope must be
-// a `Doc` from this package.
+// the MongoDB Go Driver's `primitive.CodeWithScope`, the scope must be a `Doc`
+// from this package.
 type CodeWithScope struct {
 	Code  string
 	Scope *Doc
 }
+
+// A Binary represents BSON binary data with its subtype.
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+// Undefined represents the deprecated BSON undefined value.
+type Undefined struct{}
+
+// A DateTime is a BSON UTC datetime in milliseconds since the Unix epoch.
+type DateTime int64
+
+// NewDateTimeFromTime returns the DateTime for t, truncated to milliseconds.
+func NewDateTimeFromTime(t time.Time) DateTime {
+	return DateTime(t.Unix()*1000 + int64(t.Nanosecond()/1000000))
+}
+
+// Time returns the DateTime as a time.Time in the local time zone.
+func (d DateTime) Time() time.Time {
+	return time.Unix(int64(d)/1000, int64(d)%1000*1000000)
+}
+
+// A Regex represents a BSON regular expression.  Options are single
+// characters and should be in alphabetical order.
+type Regex struct {
+	Pattern string
+	Options string
+}
+
+// A DBPointer represents the deprecated BSON DBPointer type: a namespace and
+// an ObjectID.
+type DBPointer struct {
+	DB      string
+	Pointer ObjectID
+}
+
+// JavaScript represents BSON JavaScript code without a scope.
+type JavaScript string
+
+// Symbol represents the deprecated BSON symbol type.
+type Symbol string
+
+// A Timestamp represents a BSON timestamp: seconds since the Unix epoch in T
+// and an ordinal in I.
+type Timestamp struct {
+	T uint32
+	I uint32
+}
+
+// MinKey represents the BSON min key, which sorts before all other values.
+type MinKey struct{}
+
+// MaxKey represents the BSON max key, which sorts after all other values.
+type MaxKey struct{}
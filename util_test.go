@@ -11,7 +11,7 @@ func compareDocs(t *testing.T, got, want *Doc, label string) {
 	gotHex := strings.ToLower(hex.EncodeToString(got.buf))
 	wantHex := strings.ToLower(hex.EncodeToString(want.buf))
 	if gotHex != wantHex {
-		t.Errorf("%s: docs not equal.\nGot:  %s\nWant: %s", label, gotHex, wantHex)
+		t.Errorf("%s: docs not equal.\nGot:  %s\nWant: %s\nGot:\n%sWant:\n%s", label, gotHex, wantHex, got.DebugString(), want.DebugString())
 	}
 }
 
@@ -20,7 +20,7 @@ func compareDocHex(t *testing.T, d *Doc, want string, label string) {
 	got := strings.ToLower(hex.EncodeToString(d.buf))
 	want = strings.ToLower(want)
 	if got != want {
-		t.Errorf("%s: encoded doc incorrect.\nGot:  %s\nWant: %s", label, got, want)
+		t.Errorf("%s: encoded doc incorrect.\nGot:  %s\nWant: %s\nGot:\n%s", label, got, want, d.DebugString())
 	}
 	return
 }
@@ -30,11 +30,25 @@ func compareArrayHex(t *testing.T, a *Array, want string, label string) {
 	got := strings.ToLower(hex.EncodeToString(a.d.buf))
 	want = strings.ToLower(want)
 	if got != want {
-		t.Errorf("%s: encoded array incorrect.\nGot:  %s\nWant: %s", label, got, want)
+		t.Errorf("%s: encoded array incorrect.\nGot:  %s\nWant: %s\nGot:\n%s", label, got, want, a.d.DebugString())
 	}
 	return
 }
 
+// debugHex returns the DebugString breakdown of a hex-encoded document.
+func debugHex(s string) string {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return err.Error()
+	}
+	d, err := fct.NewDocFromBytes(raw)
+	if err != nil {
+		return err.Error()
+	}
+	defer d.Release()
+	return d.DebugString()
+}
+
 func assertErr(t *testing.T, got error, want error) {
 	t.Helper()
 	if want == nil {
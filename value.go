@@ -3,15 +3,10 @@ package bsony
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var errAlreadyReleased = errors.New("value released")
-
 type Value interface {
 	Clone() Value
 	CopyTo(dst []byte) int
@@ -22,6 +17,16 @@ type Value interface {
 	Type() Type
 }
 
+// A Viewer provides immutable views of the documents nested in a value, which
+// share its bytes instead of copying them.  The Values returned by this
+// package implement it, as well as fmt.Stringer; it is separate from Value so
+// that other implementations of Value need not.
+type Viewer interface {
+	ArrayUnsafe() (*Array, error)
+	CodeScopeUnsafe() (CodeWithScope, error)
+	DocUnsafe() (*Doc, error)
+}
+
 // A unsafeValue is an immutable view into a buffer.  It must
 // not be used past the lifetime of that container.
 type unsafeValue struct {
@@ -29,229 +34,231 @@ type unsafeValue struct {
 	t       Type
 	data    []byte
 	err     error
+	src     *docDebug // source document of a view, in debug mode
 }
 
 // unsafe value is not owned -- it's just a view into another buffer.
 // it constructs a view of the given type, given that `src` is the beginning of
-// the data (i.e. after the key of a document/array)
+// the data (i.e. after the key of a document/array).  If the data is invalid,
+// the error is a DecodeError with the type.
 //
 // XXX should we have a sync.Pool for Values?
 func newValueUnsafe(f *Factory, src []byte, t Type) *unsafeValue {
 	v := &unsafeValue{factory: f, t: t}
+	data, err := parseValue(src, t)
+	if err != nil {
+		v.err = &DecodeError{Type: t, Err: err}
+		return v
+	}
+	v.data = data
+	return v
+}
+
+// parseValue returns the data of a value of type t at the start of src.
+// Errors wrap one of the sentinel decoding errors.
+func parseValue(src []byte, t Type) ([]byte, error) {
 	var err error
 	switch t {
 	case TypeInvalid:
 		// Sentinel
 	case TypeNull, TypeUndefined, TypeMinKey, TypeMaxKey:
-		v.data = src[0:0]
+		return src[0:0], nil
 
 	case TypeBoolean:
 		if err = hasEnoughBytes(src, 0, 1); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		if src[0] != 0 && src[0] != 1 {
-			v.err = fmt.Errorf("invalid boolean data byte %d", src[0])
+			return nil, errorf(ErrInvalidValue, "boolean data byte %d", src[0])
 		}
-		v.data = src[0:1]
+		return src[0:1], nil
 
 	case TypeInt32:
 		if err = hasEnoughBytes(src, 0, 4); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		v.data = src[0:4]
+		return src[0:4], nil
 
 	case TypeDouble, TypeInt64, TypeDateTime, TypeTimestamp:
 		if err = hasEnoughBytes(src, 0, 8); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		v.data = src[0:8]
+		return src[0:8], nil
 
 	case TypeObjectID:
 		if err = hasEnoughBytes(src, 0, 12); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		v.data = src[0:12]
+		return src[0:12], nil
 
 	case TypeDecimal128:
 		if err = hasEnoughBytes(src, 0, 16); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		v.data = src[0:16]
+		return src[0:16], nil
 
 	case TypeString, TypeSymbol, TypeJavaScript:
 		// Minimum bytes:  length + null == 5
 		if err = hasEnoughBytes(src, 0, 5); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		length, _ := readInt32(src, 0)
-		if length <= 0 {
-			v.err = fmt.Errorf("%s value has invalid, non-positive string length %d", t, length)
-			return v
+		strLen, _ := readInt32(src, 0)
+		if strLen <= 0 {
+			return nil, errorf(ErrInvalidLength, "non-positive string length %d", strLen)
 		}
-		// For these types, encoded length does not include itself
-		length = length + 4
-		if err = hasEnoughBytes(src, 0, int(length)); err != nil {
-			v.err = err
-			return v
+		// For these types, encoded length does not include itself; use int
+		// so a maximal length can't overflow.
+		length := int(strLen) + 4
+		if err = hasEnoughBytes(src, 0, length); err != nil {
+			return nil, err
 		}
 		// Requires null terminator or these types are invalid
 		if src[length-1] != 0 {
-			v.err = fmt.Errorf("%s value missing null terminator", t)
-			return v
+			return nil, ErrMissingTerminator
 		}
-		v.data = src[0:length]
+		return src[0:length], nil
 
 	case TypeEmbeddedDocument, TypeArray:
 		// Minimum bytes:  length + null == 5
 		if err = hasEnoughBytes(src, 0, 5); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		length, _ := readInt32(src, 0)
+		if length < 5 {
+			return nil, errorf(ErrInvalidLength, "length %d is too small", length)
+		}
 		// For these types, encoded length includes itself
 		if err = hasEnoughBytes(src, 0, int(length)); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		// Requires null terminator or these types are invalid
 		if src[length-1] != 0 {
-			v.err = fmt.Errorf("%s value missing null terminator", t)
-			return v
+			return nil, ErrMissingTerminator
 		}
-		v.data = src[0:length]
+		return src[0:length], nil
 
 	case TypeCodeWithScope:
 		// Minimum bytes:  length + length + null + length + null == 14
 		if err = hasEnoughBytes(src, 0, 14); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		length, _ := readInt32(src, 0)
 		if length <= 0 {
-			v.err = fmt.Errorf("%s: value has invalid, non-positive length %d", t, length)
-			return v
+			return nil, errorf(ErrInvalidLength, "non-positive length %d", length)
 		}
 		// For this type, encoded length includes itself
 		if err = hasEnoughBytes(src, 0, int(length)); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		// Requires null terminator for the scope or this type is invalid
 		if src[length-1] != 0 {
-			v.err = fmt.Errorf("%s: scope missing null terminator", t)
-			return v
+			return nil, fmt.Errorf("scope %w", ErrMissingTerminator)
 		}
-		// encoded string length must leave room for doc length + null
+		// encoded string length must be positive and leave room for the scope
 		strLen, _ := readInt32(src, 4)
-		if strLen == 0 {
-			v.err = fmt.Errorf("%s: value has invalid, non-positive string length %d", t, strLen)
-			return v
+		if strLen <= 0 {
+			return nil, errorf(ErrInvalidLength, "non-positive string length %d", strLen)
+		}
+		// length, string length, string and a minimal scope of 5 bytes
+		if int(length) < 8+int(strLen)+5 {
+			return nil, errorf(ErrInvalidLength, "string length %d leaves no room for scope", strLen)
 		}
-		if length-strLen < 5 {
-			v.err = fmt.Errorf("%s: string length too long", t)
-			return v
+		// Requires null terminator for the code string
+		if src[7+strLen] != 0 {
+			return nil, fmt.Errorf("code string %w", ErrMissingTerminator)
 		}
 		// encoded doc length must consume rest of the bytes
 		docLen, _ := readInt32(src, 8+int(strLen))
-		if length != 8+strLen+docLen {
-			v.err = fmt.Errorf("%s: scope size invalid", t)
-			return v
+		if docLen < 5 || int(length) != 8+int(strLen)+int(docLen) {
+			return nil, errorf(ErrInvalidLength, "scope length %d conflicts with total length %d", docLen, length)
 		}
-		v.data = src[0:length]
+		return src[0:length], nil
 
 	case TypeBinary:
 		// Minimum bytes: length + subtype byte == 5
 		if err = hasEnoughBytes(src, 0, 5); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		length, _ := readInt32(src, 0)
+		if length < 0 {
+			return nil, errorf(ErrInvalidLength, "negative length %d", length)
+		}
 		subtype := src[4]
 		// For this type, encoded length does not includes itself or the
 		// binary subtype byte
 		if err = hasEnoughBytes(src, 0, int(length)+5); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		// Subtype 2 also has a length to verify; it should be the outer length
 		// minus the 4 bytes for the inner length.
 		if subtype == 2 {
+			if length < 4 {
+				return nil, errorf(ErrInvalidLength, "subtype 2 length %d too short for inner length", length)
+			}
 			innerLength, err := readInt32(src, 5)
 			if err != nil {
-				v.err = err
-				return v
+				return nil, err
 			}
 			if length-4 != innerLength {
-				v.err = fmt.Errorf("binary subtype 2 inner length %d conflicts with outer length %d", innerLength, length)
-				return v
+				return nil, errorf(ErrInvalidLength, "subtype 2 inner length %d conflicts with outer length %d", innerLength, length)
 			}
 		}
-		v.data = src[0 : length+5]
+		return src[0 : length+5], nil
 
 	case TypeRegex:
 		// Minimum bytes: 2 cstring null terminators
 		if err = hasEnoughBytes(src, 0, 2); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
 		first := bytes.IndexByte(src, 0)
 		if first == -1 {
-			v.err = errors.New("regex cstring unterminated")
-			return v
+			return nil, fmt.Errorf("regex pattern %w", ErrMissingTerminator)
 		}
 		second := bytes.IndexByte(src[first+1:], 0)
 		if second == -1 {
-			v.err = errors.New("regex cstring unterminated")
-			return v
+			return nil, fmt.Errorf("regex options %w", ErrMissingTerminator)
 		}
 		// Length is length of each part plus two null bytes; we know the
 		// length is valid because we searched the original slice.
-		v.data = src[0 : first+second+2]
+		return src[0 : first+second+2], nil
 
 	case TypeDBPointer:
 		// Minimum bytes: length + null + 12-byte OID == 17
 		if err = hasEnoughBytes(src, 0, 17); err != nil {
-			v.err = err
-			return v
+			return nil, err
 		}
-		length, _ := readInt32(src, 0)
-		if length <= 0 {
-			v.err = fmt.Errorf("%s value has invalid, non-positive string length %d", t, length)
-			return v
+		strLen, _ := readInt32(src, 0)
+		if strLen <= 0 {
+			return nil, errorf(ErrInvalidLength, "non-positive string length %d", strLen)
 		}
-		// For this type, encoded length does not include itself
-		length += 4
+		// For this type, encoded length does not include itself; use int so
+		// a maximal length can't overflow.
+		length := int(strLen) + 4
 		// Total length adds trailing 12 bytes of OID
 		totalLength := length + 12
-		if err = hasEnoughBytes(src, 0, int(totalLength)); err != nil {
-			v.err = err
-			return v
+		if err = hasEnoughBytes(src, 0, totalLength); err != nil {
+			return nil, err
 		}
 		// Requires null terminator of string part
 		if src[length-1] != 0 {
-			v.err = fmt.Errorf("%s value missing null terminator", t)
-			return v
+			return nil, ErrMissingTerminator
 		}
-		v.data = src[0:totalLength]
+		return src[0:totalLength], nil
 	default:
-		v.err = fmt.Errorf("Unknown BSON type '%02x'", t)
+		return nil, errorf(ErrUnknownType, "0x%02x", byte(t))
 	}
-	return v
+	return nil, nil
 }
 
 // Clone returns a copy of an value, including copying the underlying data
 // buffer.
 func (v *unsafeValue) Clone() Value {
+	v.src.check("Value.Clone")
 	return newOwnedValue(v.factory, v)
 }
 
 func (v *unsafeValue) CopyTo(dst []byte) int {
+	v.src.check("Value.CopyTo")
 	return copy(dst, v.data)
 }
 
@@ -270,7 +277,7 @@ func (v *unsafeValue) Release() {
 	v.factory = nil
 	v.data = nil
 	v.t = TypeInvalid
-	v.err = errAlreadyReleased
+	v.err = ErrBufferReleased
 }
 
 // Type ...
@@ -282,6 +289,7 @@ func (v *unsafeValue) Type() Type {
 // decoded.  It is safe to keep the result of a Get and release the source
 // document.
 func (v *unsafeValue) Get() interface{} {
+	v.src.check("Value.Get")
 	if v.err != nil {
 		return nil
 	}
@@ -293,13 +301,13 @@ func (v *unsafeValue) Get() interface{} {
 		return nil
 
 	case TypeUndefined:
-		return primitive.Undefined{}
+		return Undefined{}
 
 	case TypeMinKey:
-		return primitive.MinKey{}
+		return MinKey{}
 
 	case TypeMaxKey:
-		return primitive.MaxKey{}
+		return MaxKey{}
 
 	case TypeBoolean:
 		return v.data[0] != 0
@@ -325,17 +333,17 @@ func (v *unsafeValue) Get() interface{} {
 	case TypeTimestamp:
 		inc := binary.LittleEndian.Uint32(v.data[0:4])
 		sec := binary.LittleEndian.Uint32(v.data[4:8])
-		return primitive.Timestamp{T: sec, I: inc}
+		return Timestamp{T: sec, I: inc}
 
 	case TypeObjectID:
-		x := primitive.ObjectID{}
+		x := ObjectID{}
 		copy(x[0:12], v.data)
 		return x
 
 	case TypeDecimal128:
 		l := binary.LittleEndian.Uint64(v.data[0:8])
 		h := binary.LittleEndian.Uint64(v.data[8:16])
-		return primitive.NewDecimal128(h, l)
+		return NewDecimal128(h, l)
 
 	case TypeString:
 		// Skip length and omit trailing null byte.
@@ -343,34 +351,37 @@ func (v *unsafeValue) Get() interface{} {
 
 	case TypeSymbol:
 		// Skip length and omit trailing null byte.
-		return primitive.Symbol(v.data[4 : len(v.data)-1])
+		return Symbol(v.data[4 : len(v.data)-1])
 
 	case TypeJavaScript:
 		// Skip length and omit trailing null byte.
-		return primitive.JavaScript(v.data[4 : len(v.data)-1])
+		return JavaScript(v.data[4 : len(v.data)-1])
 
 	case TypeEmbeddedDocument:
-		// XXX validate?
-		src := &Doc{factory: v.factory, buf: v.data, valid: true, immutable: true}
+		src, err := v.DocUnsafe()
+		if err != nil {
+			return nil
+		}
 		return src.Clone()
 
 	case TypeArray:
-		// XXX validate?
-		src := &Array{d: &Doc{factory: v.factory, buf: v.data, valid: true, immutable: true}}
+		src, err := v.ArrayUnsafe()
+		if err != nil {
+			return nil
+		}
 		return src.Clone()
 
 	case TypeCodeWithScope:
-		// Skip total CWS length to get just string length; omit trailing null
-		data := v.data[4:]
-		strLen, _ := readInt32(data, 0)
-		code := string(data[4 : 4+strLen-1])
-		src := &Doc{factory: v.factory, buf: data[4+strLen:], valid: true, immutable: true}
-		scope := src.Clone()
-		return CodeWithScope{Code: code, Scope: scope}
+		x, err := v.CodeScopeUnsafe()
+		if err != nil {
+			return nil
+		}
+		x.Scope = x.Scope.Clone()
+		return x
 
 	case TypeBinary:
 		// Skip the length to find the subtype byte
-		x := primitive.Binary{Subtype: v.data[4]}
+		x := Binary{Subtype: v.data[4]}
 		payload := v.data[5:]
 		// Legacy subtype 2 has another length after subtype byte
 		if x.Subtype == 2 {
@@ -384,19 +395,85 @@ func (v *unsafeValue) Get() interface{} {
 		pattern, _ := readCString(v.data, 0)
 		// Skip first string and trailing null byte
 		options, _ := readCString(v.data, len(pattern)+1)
-		return primitive.Regex{Pattern: pattern, Options: options}
+		return Regex{Pattern: pattern, Options: options}
 
 	case TypeDBPointer:
 		strLen, _ := readInt32(v.data, 0)
 		ref := string(v.data[4 : 4+strLen-1])
-		id := primitive.ObjectID{}
+		id := ObjectID{}
 		copy(id[0:12], v.data[strLen+4:])
-		return primitive.DBPointer{DB: ref, Pointer: id}
+		return DBPointer{DB: ref, Pointer: id}
 	}
 
 	return nil
 }
 
+// DocUnsafe returns an embedded document value as an immutable view that
+// shares the value's bytes instead of copying them.  The framing of the
+// document is checked, but its elements are only checked when iterated.
+// It returns an error if the value isn't an embedded document or is
+// invalid.
+//
+// WARNING: the view directly references the underlying data; because buffers
+// may be reused, you MUST NOT keep the view beyond the lifetime of the source
+// document or value.  Releasing the view has no effect.
+func (v *unsafeValue) DocUnsafe() (*Doc, error) {
+	v.src.check("Value.DocUnsafe")
+	if v.err != nil {
+		return nil, v.err
+	}
+	if v.t != TypeEmbeddedDocument {
+		return nil, fmt.Errorf("%w: %s is not %s", ErrWrongType, v.t, TypeEmbeddedDocument)
+	}
+	return v.view(v.data)
+}
+
+// ArrayUnsafe returns an array value as an immutable view, as for DocUnsafe.
+func (v *unsafeValue) ArrayUnsafe() (*Array, error) {
+	v.src.check("Value.ArrayUnsafe")
+	if v.err != nil {
+		return nil, v.err
+	}
+	if v.t != TypeArray {
+		return nil, fmt.Errorf("%w: %s is not %s", ErrWrongType, v.t, TypeArray)
+	}
+	d, err := v.view(v.data)
+	if err != nil {
+		return nil, err
+	}
+	return &Array{d: d}, nil
+}
+
+// CodeScopeUnsafe returns a JavaScript code with scope value with a copy of
+// the code and the scope as an immutable view, as for DocUnsafe.
+func (v *unsafeValue) CodeScopeUnsafe() (CodeWithScope, error) {
+	v.src.check("Value.CodeScopeUnsafe")
+	if v.err != nil {
+		return CodeWithScope{}, v.err
+	}
+	if v.t != TypeCodeWithScope {
+		return CodeWithScope{}, fmt.Errorf("%w: %s is not %s", ErrWrongType, v.t, TypeCodeWithScope)
+	}
+	// Skip total CWS length to get just string length; omit trailing null
+	data := v.data[4:]
+	strLen, _ := readInt32(data, 0)
+	scope, err := v.view(data[4+strLen:])
+	if err != nil {
+		return CodeWithScope{}, err
+	}
+	return CodeWithScope{Code: string(data[4 : 4+strLen-1]), Scope: scope}, nil
+}
+
+// view returns an immutable document sharing buf, after checking its
+// framing.  In debug mode, the view shares the debug record of the source
+// document, so using it after the source is released panics.
+func (v *unsafeValue) view(buf []byte) (*Doc, error) {
+	if err := validateBSONFraming(buf); err != nil {
+		return nil, err
+	}
+	return &Doc{factory: v.factory, buf: buf, valid: true, immutable: true, dbg: v.src}, nil
+}
+
 // XXX Have methods that return typed values?
 // func (...) Int32OK() (int32, bool)
 
@@ -411,17 +488,23 @@ type ownedValue struct {
 func newOwnedValue(f *Factory, e Value) *ownedValue {
 	var buf []byte
 	if e.Type() != TypeInvalid {
-		buf = f.pool.Resize(f.pool.Get(), e.Len())
+		buf = f.get(e.Len())
 		e.CopyTo(buf)
 	}
-	return &ownedValue{
+	o := &ownedValue{
 		unsafeValue: unsafeValue{factory: f, data: buf, t: e.Type(), err: e.Err()},
 		buf:         buf,
 	}
+	f.track(o)
+	return o
 }
 
-// Release returns the owned buffer to the pool.
+// Release returns the owned buffer to the pool.  Releasing an already
+// released value has no effect.
 func (o *ownedValue) Release() {
+	if o.factory == nil {
+		return
+	}
 	o.factory.release(o.buf)
 	o.buf = nil
 	o.unsafeValue.Release()
@@ -3,6 +3,7 @@ package bsony
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -80,16 +81,16 @@ func TestNewUnsafeValue_TooShort(t *testing.T) {
 		for _, bt := range c.types {
 			// nil buffer
 			uv := newValueUnsafe(fct, nil, bt)
-			if uv.Err() != errShortDoc {
-				t.Errorf("for type %s with nil buffer, expected '%v', got '%v'", bt, errShortDoc, uv.Err())
+			if !errors.Is(uv.Err(), ErrShortDoc) {
+				t.Errorf("for type %s with nil buffer, expected '%v', got '%v'", bt, ErrShortDoc, uv.Err())
 			}
 			uv.Release()
 
 			// short buffer
 			buf := make([]byte, c.minLen-1)
 			uv = newValueUnsafe(fct, buf, bt)
-			if uv.Err() != errShortDoc {
-				t.Errorf("for type %s, expected '%v', got '%v'", bt, errShortDoc, uv.Err())
+			if !errors.Is(uv.Err(), ErrShortDoc) {
+				t.Errorf("for type %s, expected '%v', got '%v'", bt, ErrShortDoc, uv.Err())
 			}
 			uv.Release()
 		}
@@ -159,8 +160,8 @@ func TestNewUnsafeValue_BadLeadingLength(t *testing.T) {
 		writeInt32(buf, 0, int32(l))
 
 		uv := newValueUnsafe(fct, buf, c.bt)
-		if uv.Err() != errShortDoc {
-			t.Errorf("for type %s, expected '%v', got '%v'", c.bt, errShortDoc, uv.Err())
+		if !errors.Is(uv.Err(), ErrShortDoc) {
+			t.Errorf("for type %s, expected '%v', got '%v'", c.bt, ErrShortDoc, uv.Err())
 		}
 		uv.Release()
 
@@ -173,13 +174,60 @@ func TestNewUnsafeValue_BadLeadingLength(t *testing.T) {
 			buf[n] = 0
 		}
 		uv = newValueUnsafe(fct, buf, c.bt)
-		if uv.Err() != errShortDoc {
-			t.Errorf("for type %s, expected '%v', got '%v'", c.bt, errShortDoc, uv.Err())
+		if !errors.Is(uv.Err(), ErrShortDoc) {
+			t.Errorf("for type %s, expected '%v', got '%v'", c.bt, ErrShortDoc, uv.Err())
 		}
 		uv.Release()
 	}
 }
 
+// Lengths that are negative, too small or near the int32 maximum must be
+// reported as errors rather than crash.
+func TestNewUnsafeValue_HostileLength(t *testing.T) {
+	fct := New()
+
+	cases := []struct {
+		label  string
+		bt     Type
+		src    string
+		errStr string
+	}{
+		{"negative binary length", TypeBinary, "fbffffff 00 00000000", "negative length"},
+		{"short binary subtype 2", TypeBinary, "03000000 02 ffffffff 00", "too short for inner length"},
+		{"zero document length", TypeEmbeddedDocument, "00000000 00", "length 0 is too small"},
+		{"negative array length", TypeArray, "fbffffff 00", "length -5 is too small"},
+		{"maximal string length", TypeString, "ffffff7f 00 00", ErrShortDoc.Error()},
+		{"maximal DBPointer length", TypeDBPointer, "ffffff7f 00 000000000000000000000000", ErrShortDoc.Error()},
+	}
+
+	for _, c := range cases {
+		buf, err := hex.DecodeString(strings.ReplaceAll(c.src, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uv := newValueUnsafe(fct, buf, c.bt)
+		if uv.Err() == nil || !strings.Contains(uv.Err().Error(), c.errStr) {
+			t.Errorf("%s: expected '%v', got '%v'", c.label, c.errStr, uv.Err())
+		}
+	}
+}
+
+func TestIterStopsAfterError(t *testing.T) {
+	// The string "a" has a bad length, so the iterator can't find "b".
+	buf, _ := hex.DecodeString("1500000002610010000000620010620001000000" + "00")
+	doc, err := New().NewDocFromBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := doc.Iter()
+	if !iter.Next() || iter.Err() == nil {
+		t.Fatal("expected error for first value")
+	}
+	if iter.Next() {
+		t.Errorf("iterator continued after error with key %q", iter.Key())
+	}
+}
+
 // Code with scope has several ways the internal structure can be invalid
 func TestNewUnsafeValue_BadCodeWithScope(t *testing.T) {
 	fct := New()
@@ -192,27 +240,42 @@ func TestNewUnsafeValue_BadCodeWithScope(t *testing.T) {
 		{
 			label:  "length exceeds buffer",
 			src:    "0f000000 01000000 00 05000000 00",
-			errStr: errShortDoc.Error(),
+			errStr: ErrShortDoc.Error(),
 		},
 		{
 			label:  "length exceeds null terminator",
 			src:    "0f000000 01000000 00 05000000 00 ff",
-			errStr: "code with scope: scope missing null terminator",
+			errStr: "scope missing null terminator",
 		},
 		{
 			label:  "zero string length",
 			src:    "0e000000 00000000 05000000 00 00",
-			errStr: "invalid, non-positive string length",
+			errStr: "non-positive string length",
 		},
 		{
 			label:  "zero string length",
 			src:    "0e000000 0a000000 00 05000000 00",
-			errStr: "string length too long",
+			errStr: "leaves no room for scope",
 		},
 		{
 			label:  "zero string length",
 			src:    "0e000000 01000000 00 06000000 00",
-			errStr: "scope size invalid",
+			errStr: "conflicts with total length",
+		},
+		{
+			label:  "negative string length",
+			src:    "0e000000 fbffffff 00 05000000 00",
+			errStr: "non-positive string length",
+		},
+		{
+			label:  "code missing null terminator",
+			src:    "0e000000 01000000 61 05000000 00",
+			errStr: "code string missing null terminator",
+		},
+		{
+			label:  "scope length too short",
+			src:    "0f000000 02000000 6100 01000000 00",
+			errStr: "conflicts with total length",
 		},
 	}
 
@@ -268,3 +331,85 @@ func TestValueCloning(t *testing.T) {
 	v2.Release()
 	v3.Release()
 }
+
+func TestValueViews(t *testing.T) {
+	fct := New()
+	doc := fct.NewDoc().
+		AddDoc("d", fct.NewDoc().AddInt32("x", 1)).
+		AddArray("a", fct.NewArray(int32(1))).
+		AddCodeScope("c", CodeWithScope{Code: "f", Scope: fct.NewDoc().AddInt32("y", 2)}).
+		AddInt32("i", 3)
+	defer doc.Release()
+	before := hex.EncodeToString(doc.buf)
+
+	var views []*Doc
+	iter := doc.Iter()
+	for iter.Next() {
+		v := iter.ValueUnsafe().(Viewer)
+		uv := v.(*unsafeValue)
+		var view *Doc
+		var err error
+		switch iter.Type() {
+		case TypeEmbeddedDocument:
+			view, err = v.DocUnsafe()
+			compareDocHex(t, view, "0c0000001078000100000000", "DocUnsafe")
+		case TypeArray:
+			var a *Array
+			a, err = v.ArrayUnsafe()
+			if a != nil {
+				view = a.d
+				compareArrayHex(t, a, "0c0000001030000100000000", "ArrayUnsafe")
+			}
+		case TypeCodeWithScope:
+			var cs CodeWithScope
+			cs, err = v.CodeScopeUnsafe()
+			if cs.Code != "f" {
+				t.Errorf("CodeScopeUnsafe code incorrect: %q", cs.Code)
+			}
+			view = cs.Scope
+			compareDocHex(t, view, "0c0000001079000200000000", "CodeScopeUnsafe")
+		default:
+			_, err = v.DocUnsafe()
+			assertErrIs(t, err, ErrWrongType)
+			_, err = v.ArrayUnsafe()
+			assertErrIs(t, err, ErrWrongType)
+			_, err = v.CodeScopeUnsafe()
+			assertErrIs(t, err, ErrWrongType)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s view: %v", iter.Type(), err)
+		}
+		end := &uv.data[len(uv.data)-1]
+		if &view.buf[len(view.buf)-1] != end {
+			t.Errorf("%s view doesn't share the source buffer", iter.Type())
+		}
+		views = append(views, view)
+	}
+	if len(views) != 3 {
+		t.Fatalf("expected 3 views, got %d", len(views))
+	}
+
+	for _, view := range views {
+		view.AddInt32("z", 0)
+		assertErr(t, view.Err(), ErrImmutable)
+		view.Release()
+		if !view.Valid() {
+			t.Error("releasing a view invalidated it")
+		}
+	}
+	compareDocHex(t, doc, before, "source doc after views")
+
+	// A value with a parse error reports it instead of a view.
+	bad := newValueUnsafe(fct, []byte{6, 0, 0, 0, 0, 1}, TypeEmbeddedDocument)
+	if _, err := bad.DocUnsafe(); err == nil || err != bad.Err() {
+		t.Errorf("expected value error, got %v", err)
+	}
+}
+
+func assertErrIs(t *testing.T, got error, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("expected '%v', got '%v'", want, got)
+	}
+}
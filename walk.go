@@ -0,0 +1,126 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+// A WalkAction tells Walk how to proceed after visiting a value.
+type WalkAction int
+
+// Walk actions
+const (
+	// WalkContinue continues the walk, descending into the value if it is a
+	// document, array or code with scope.
+	WalkContinue WalkAction = iota
+	// WalkSkip continues the walk without descending into the value.
+	WalkSkip
+	// WalkStop ends the walk.
+	WalkStop
+)
+
+// A WalkFunc is called by Walk for each value.  The path holds the keys from
+// the top-level document down to the value; array elements have their index
+// as key and the elements of a code with scope scope follow the key of the
+// code with scope.
+//
+// WARNING: the path and the value are only valid during the call: the path
+// is reused for the next value and the value directly references the
+// underlying data, as for DocIter.ValueUnsafe.  Copy them to keep them.
+type WalkFunc func(path []string, v Value) WalkAction
+
+// Walk calls fn for each value in d, depth first in document order,
+// descending into embedded documents, arrays and code with scope scopes.
+// Each container is visited before its elements.  It returns the first
+// error parsing a value, as a DecodeError with the dotted path to the value
+// and its offset in d, or nil if the walk finishes or is stopped.  If the
+// factory of d has a maximum depth, Walk returns a DecodeError wrapping
+// ErrTooDeep instead of descending into a container whose elements would
+// exceed it.
+func Walk(d *Doc, fn WalkFunc) error {
+	if !d.valid {
+		return d.err
+	}
+	w := walker{fn: fn, limits: d.factory.limits}
+	_, err := w.walkDoc(d, 0)
+	return err
+}
+
+type walker struct {
+	fn     WalkFunc
+	limits limits
+	path   []string
+}
+
+// walkDoc walks the elements of d, which starts at offset base in the
+// top-level document.  It returns false if the walk should end, either
+// because it was stopped or because of an error.
+func (w *walker) walkDoc(d *Doc, base int) (bool, error) {
+	iter := d.Iter()
+	for iter.Next() {
+		w.path = append(w.path, iter.Key())
+		if err := iter.Err(); err != nil {
+			return false, w.error(base, iter, err)
+		}
+		switch w.fn(w.path, iter.vu) {
+		case WalkStop:
+			return false, nil
+		case WalkSkip:
+		default:
+			sub, err := subDoc(iter.vu)
+			if err == nil && sub != nil {
+				err = w.limits.checkDepth(len(w.path) + 1)
+			}
+			if err != nil {
+				return false, w.error(base, iter, err)
+			}
+			if sub != nil {
+				if ok, err := w.walkDoc(sub, subOffset(base, iter, sub)); !ok {
+					return false, err
+				}
+			}
+		}
+		w.path = w.path[:len(w.path)-1]
+	}
+	if iter.err != nil {
+		return false, w.error(base, iter, iter.err)
+	}
+	return true, nil
+}
+
+// error returns err as a DecodeError for the current element of iter, whose
+// document starts at offset base.
+func (w *walker) error(base int, iter *DocIter, err error) error {
+	return elementError(base, iter, w.path, err)
+}
+
+// subDoc returns a view of the document holding the elements of a
+// container value, or nil if v isn't a container.
+func subDoc(v *unsafeValue) (*Doc, error) {
+	switch v.t {
+	case TypeEmbeddedDocument:
+		return v.DocUnsafe()
+	case TypeArray:
+		a, err := v.ArrayUnsafe()
+		if err != nil {
+			return nil, err
+		}
+		return a.d, nil
+	case TypeCodeWithScope:
+		cs, err := v.CodeScopeUnsafe()
+		if err != nil {
+			return nil, err
+		}
+		return cs.Scope, nil
+	}
+	return nil, nil
+}
+
+// subOffset returns the offset of sub, the document of the container value at
+// iter, in a top-level document in which the iterated document starts at
+// offset base.
+func subOffset(base int, iter *DocIter, sub *Doc) int {
+	// The type byte, key and null byte precede the value, which sub ends.
+	return base + iter.offset + iter.keyLen + 2 + len(iter.vu.data) - sub.Len()
+}
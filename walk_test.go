@@ -0,0 +1,102 @@
+// Copyright 2018 by David A. Golden. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsony
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	fct := New()
+	doc := fct.NewDoc().
+		AddInt32("a", 1).
+		AddDoc("d", fct.NewDoc().AddInt32("x", 1).AddArray("y", fct.NewArray(true, fct.NewDoc().AddNull("z")))).
+		AddCodeScope("c", CodeWithScope{Code: "f", Scope: fct.NewDoc().AddInt32("s", 1)}).
+		AddString("b", "t")
+	defer doc.Release()
+
+	walk := func(action func(path string) WalkAction) []string {
+		var paths []string
+		err := Walk(doc, func(path []string, v Value) WalkAction {
+			p := strings.Join(path, ".")
+			paths = append(paths, p+"="+v.Type().String())
+			return action(p)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+
+	cases := []struct {
+		label  string
+		action func(path string) WalkAction
+		want   []string
+	}{
+		{
+			label:  "continue",
+			action: func(string) WalkAction { return WalkContinue },
+			want: []string{
+				"a=32-bit integer", "d=embedded document", "d.x=32-bit integer",
+				"d.y=array", "d.y.0=boolean", "d.y.1=embedded document", "d.y.1.z=null",
+				"c=code with scope", "c.s=32-bit integer", "b=string",
+			},
+		},
+		{
+			label: "skip",
+			action: func(p string) WalkAction {
+				if p == "d" || p == "c" {
+					return WalkSkip
+				}
+				return WalkContinue
+			},
+			want: []string{"a=32-bit integer", "d=embedded document", "c=code with scope", "b=string"},
+		},
+		{
+			label: "stop",
+			action: func(p string) WalkAction {
+				if p == "d.y.0" {
+					return WalkStop
+				}
+				return WalkContinue
+			},
+			want: []string{"a=32-bit integer", "d=embedded document", "d.x=32-bit integer", "d.y=array", "d.y.0=boolean"},
+		},
+	}
+
+	for _, c := range cases {
+		if got := walk(c.action); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: wrong paths:\n got %v\nwant %v", c.label, got, c.want)
+		}
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	fct := New()
+	doc := fct.NewDoc().AddInt32("a", 1).AddDoc("d", fct.NewDoc().AddString("x", "ab"))
+	// Corrupt the length of the string "d.x".
+	doc.buf[21] = 0x7f
+	var visited []string
+	err := Walk(doc, func(path []string, v Value) WalkAction {
+		visited = append(visited, strings.Join(path, "."))
+		return WalkContinue
+	})
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Path != "d.x" || de.Offset != 18 || de.Type != TypeString {
+		t.Errorf("expected string error for d.x at offset 18, got %v", err)
+	}
+	assertErrIs(t, err, ErrShortDoc)
+	if !reflect.DeepEqual(visited, []string{"a", "d"}) {
+		t.Errorf("wrong paths visited: %v", visited)
+	}
+
+	doc.Release()
+	assertErr(t, Walk(doc, func([]string, Value) WalkAction { return WalkContinue }), ErrBufferReleased)
+}